@@ -1,8 +1,11 @@
 package fsx
 
 import (
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
+	"testing/fstest"
 	"time"
 )
 
@@ -278,3 +281,73 @@ func TestDirCount(t *testing.T) {
 		})
 	}
 }
+
+func TestMemoryOutput(t *testing.T) {
+	m := NewMemoryOutput()
+	f := filepath.Join("build", "posts", "post1.html")
+	if err := m.WriteFile(f, []byte("Post 1")); err != nil {
+		t.Fatal(err)
+	}
+	if !m.FileExists(f) || m.DirExists(f) {
+		t.Errorf("FileExists(%q) = false", f)
+	}
+	if !m.DirExists(filepath.Join("build", "posts")) || !m.DirExists("build") {
+		t.Errorf("DirExists() = false, want true")
+	}
+	if got := m.Text(f); got != "Post 1" {
+		t.Errorf("Text() = %q, want %q", got, "Post 1")
+	}
+	if err := m.WriteFile(filepath.Join("build", "posts"), nil); err == nil {
+		t.Errorf("WriteFile() to directory error = nil")
+	}
+	m.WriteFile(filepath.Join("build", "index.html"), nil)
+	if got := m.Files("build"); !reflect.DeepEqual(got, []string{filepath.Join("build", "index.html"), f}) {
+		t.Errorf("Files() = %v", got)
+	}
+	if err := m.Remove(f); err != nil || m.FileExists(f) {
+		t.Errorf("Remove() error = %v", err)
+	}
+	if err := m.Remove(f); err == nil {
+		t.Errorf("Remove() missing file error = nil")
+	}
+	m.WriteFile(f, nil)
+	m.Clear("build")
+	if len(m.Files("build")) != 0 || m.DirExists(filepath.Join("build", "posts")) || !m.DirExists("build") {
+		t.Errorf("Clear() did not delete directory contents")
+	}
+}
+
+func TestDirFS(t *testing.T) {
+	root := filepath.Join(string(filepath.Separator)+"site", "content")
+	d := DirFS{Root: root, FS: fstest.MapFS{
+		"index.md":    {Data: []byte("Home")},
+		"posts/a.md":  {Data: []byte("A")},
+		"posts/b.txt": {Data: []byte("B")},
+	}}
+	if got, err := d.ReadFile(filepath.Join(root, "posts", "a.md")); err != nil || got != "A" {
+		t.Errorf("ReadFile() = %q, %v", got, err)
+	}
+	if _, err := d.ReadFile(filepath.Join(root, "..", "x.md")); err == nil {
+		t.Errorf("ReadFile() outside root error = nil")
+	}
+	if !d.DirExists(root) || !d.DirExists(filepath.Join(root, "posts")) || d.FileExists(filepath.Join(root, "posts")) {
+		t.Errorf("DirExists() = false, want true")
+	}
+	files := []string{}
+	err := d.Walk(root, func(f string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && f != root {
+			return filepath.SkipDir
+		}
+		files = append(files, f)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{root, filepath.Join(root, "index.md")}; !reflect.DeepEqual(files, want) {
+		t.Errorf("Walk() = %v, want %v", files, want)
+	}
+}
@@ -0,0 +1,272 @@
+package fsx
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+/*
+Virtual file systems.
+*/
+
+// DirFS maps the OS file paths of the files in directory Root to files in the
+// FS file system e.g. if Root is `/site/content` then `/site/content/posts/x.md`
+// is read from `posts/x.md` in FS. If FS is nil files are read from the OS
+// file system.
+type DirFS struct {
+	Root string
+	FS   fs.FS
+}
+
+// fsName returns the FS name of file path name.
+func (d DirFS) fsName(name string) (string, error) {
+	if !PathIsInDir(name, d.Root) {
+		return "", &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	rel, err := filepath.Rel(d.Root, name)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+func (d DirFS) Stat(name string) (fs.FileInfo, error) {
+	if d.FS == nil {
+		return os.Stat(name)
+	}
+	n, err := d.fsName(name)
+	if err != nil {
+		return nil, err
+	}
+	return fs.Stat(d.FS, n)
+}
+
+func (d DirFS) DirExists(name string) bool {
+	info, err := d.Stat(name)
+	return err == nil && info.IsDir()
+}
+
+func (d DirFS) FileExists(name string) bool {
+	info, err := d.Stat(name)
+	return err == nil && !info.IsDir()
+}
+
+func (d DirFS) ReadFile(name string) (string, error) {
+	if d.FS == nil {
+		return ReadFile(name)
+	}
+	n, err := d.fsName(name)
+	if err != nil {
+		return "", err
+	}
+	bytes, err := fs.ReadFile(d.FS, n)
+	return string(bytes), err
+}
+
+// Walk walks the file tree rooted at OS directory path root in lexical order
+// (see filepath.Walk).
+func (d DirFS) Walk(root string, fn filepath.WalkFunc) error {
+	if d.FS == nil {
+		return filepath.Walk(root, fn)
+	}
+	n, err := d.fsName(root)
+	if err != nil {
+		return fn(root, nil, err)
+	}
+	return fs.WalkDir(d.FS, n, func(p string, de fs.DirEntry, err error) error {
+		f := filepath.Join(d.Root, filepath.FromSlash(p))
+		if err != nil {
+			return fn(f, nil, err)
+		}
+		info, err := de.Info()
+		if err != nil {
+			return fn(f, nil, err)
+		}
+		return fn(f, info, nil)
+	})
+}
+
+// Output is a writable file system. File names are OS file paths.
+type Output interface {
+	// WriteFile writes file name creating any missing parent directories.
+	WriteFile(name string, data []byte) error
+	ReadFile(name string) ([]byte, error)
+	// FileExists returns true if file name exists and is not a directory.
+	FileExists(name string) bool
+	// DirExists returns true if directory name exists.
+	DirExists(name string) bool
+	// MkdirAll creates directory name along with any missing parents.
+	MkdirAll(name string) error
+	Remove(name string) error
+	// Clear deletes the contents of directory name.
+	Clear(name string) error
+}
+
+// StatOutput is an Output that reports build file information. Outputs that
+// implement it allow up to date build files to be skipped.
+type StatOutput interface {
+	Output
+	Stat(name string) (fs.FileInfo, error)
+}
+
+// DiskOutput writes to the OS file system.
+type DiskOutput struct{}
+
+func (DiskOutput) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (DiskOutput) WriteFile(name string, data []byte) error {
+	if err := MkMissingDir(filepath.Dir(name)); err != nil {
+		return err
+	}
+	return os.WriteFile(name, data, 0644)
+}
+
+func (DiskOutput) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+
+func (DiskOutput) FileExists(name string) bool {
+	return FileExists(name)
+}
+
+func (DiskOutput) DirExists(name string) bool {
+	return DirExists(name)
+}
+
+func (DiskOutput) MkdirAll(name string) error {
+	return MkMissingDir(name)
+}
+
+func (DiskOutput) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (DiskOutput) Clear(name string) error {
+	files, _ := filepath.Glob(filepath.Join(name, "*"))
+	for _, f := range files {
+		if err := os.RemoveAll(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MemoryOutput is an in-memory Output. It is safe for concurrent use.
+type MemoryOutput struct {
+	mutex *sync.Mutex
+	files map[string][]byte // Keyed by cleaned file path.
+	dirs  map[string]bool   // Keyed by cleaned directory path.
+}
+
+func NewMemoryOutput() MemoryOutput {
+	return MemoryOutput{
+		mutex: &sync.Mutex{},
+		files: map[string][]byte{},
+		dirs:  map[string]bool{},
+	}
+}
+
+// mkdirAll adds directory name and its parents. The mutex must be locked.
+func (m MemoryOutput) mkdirAll(name string) {
+	for name = filepath.Clean(name); !m.dirs[name]; name = filepath.Dir(name) {
+		m.dirs[name] = true
+	}
+}
+
+func (m MemoryOutput) WriteFile(name string, data []byte) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	name = filepath.Clean(name)
+	if m.dirs[name] {
+		return &fs.PathError{Op: "write", Path: name, Err: fs.ErrExist}
+	}
+	m.mkdirAll(filepath.Dir(name))
+	m.files[name] = append([]byte{}, data...)
+	return nil
+}
+
+func (m MemoryOutput) ReadFile(name string) ([]byte, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	data, ok := m.files[filepath.Clean(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return append([]byte{}, data...), nil
+}
+
+func (m MemoryOutput) FileExists(name string) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	_, ok := m.files[filepath.Clean(name)]
+	return ok
+}
+
+func (m MemoryOutput) DirExists(name string) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.dirs[filepath.Clean(name)]
+}
+
+func (m MemoryOutput) MkdirAll(name string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, ok := m.files[filepath.Clean(name)]; ok {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+	}
+	m.mkdirAll(name)
+	return nil
+}
+
+func (m MemoryOutput) Remove(name string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	name = filepath.Clean(name)
+	if _, ok := m.files[name]; !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	delete(m.files, name)
+	return nil
+}
+
+func (m MemoryOutput) Clear(name string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	name = filepath.Clean(name)
+	for f := range m.files {
+		if f != name && PathIsInDir(f, name) {
+			delete(m.files, f)
+		}
+	}
+	for d := range m.dirs {
+		if d != name && PathIsInDir(d, name) {
+			delete(m.dirs, d)
+		}
+	}
+	return nil
+}
+
+// Files returns the sorted paths of the files in directory dir.
+func (m MemoryOutput) Files(dir string) []string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	result := []string{}
+	for f := range m.files {
+		if PathIsInDir(f, dir) {
+			result = append(result, f)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Text returns the contents of file name (blank if the file does not exist).
+func (m MemoryOutput) Text(name string) string {
+	data, _ := m.ReadFile(name)
+	return string(data)
+}
@@ -0,0 +1,346 @@
+package highlight
+
+/*
+Source code syntax highlighter.
+
+Highlighted code is HTML escaped and its tokens are wrapped in `<span>`
+elements with `hl-<class>` classes that are styled by theme CSS.
+*/
+
+import (
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Token classes.
+const (
+	Comment   = "c" // Comments.
+	Keyword   = "k" // Language keywords.
+	Type      = "t" // Built-in types and functions.
+	Literal   = "l" // Named constants e.g. true, false, nil.
+	String    = "s" // String and character literals.
+	Number    = "n" // Numeric literals.
+	Function  = "f" // Function names.
+	Attribute = "a" // Attribute names and object keys.
+	Tag       = "g" // Markup tags.
+	Variable  = "v" // Shell variables.
+)
+
+// Highlight returns HTML escaped code with syntax highlighted tokens. ok is
+// false if the language is not supported.
+func Highlight(code, lang string) (result string, ok bool) {
+	l, ok := languages[strings.ToLower(lang)]
+	if !ok {
+		return "", false
+	}
+	lx := lexer{lang: l, src: code}
+	if l.markup {
+		lx.lexMarkup()
+	} else {
+		lx.lex()
+	}
+	return lx.out.String(), true
+}
+
+// Supported returns true if the language is supported.
+func Supported(lang string) bool {
+	_, ok := languages[strings.ToLower(lang)]
+	return ok
+}
+
+type lexer struct {
+	lang  *language
+	src   string
+	pos   int
+	depth int // Brace nesting depth.
+	out   strings.Builder
+}
+
+// emit writes HTML escaped text wrapped in a span with the token class.
+func (lx *lexer) emit(class, text string) {
+	if text == "" {
+		return
+	}
+	if class == "" {
+		lx.out.WriteString(html.EscapeString(text))
+		return
+	}
+	lx.out.WriteString(`<span class="hl-` + class + `">`)
+	lx.out.WriteString(html.EscapeString(text))
+	lx.out.WriteString(`</span>`)
+}
+
+// next consumes and returns the text up to position end.
+func (lx *lexer) next(end int) string {
+	if end > len(lx.src) {
+		end = len(lx.src)
+	}
+	text := lx.src[lx.pos:end]
+	lx.pos = end
+	return text
+}
+
+// until consumes text up to and including delimiter delim, or to the end of
+// the source if it is missing.
+func (lx *lexer) until(start int, delim string) string {
+	i := strings.Index(lx.src[start:], delim)
+	if i == -1 {
+		return lx.next(len(lx.src))
+	}
+	return lx.next(start + i + len(delim))
+}
+
+// lineStart returns true if the current position is preceded by only
+// whitespace on the current line.
+func (lx *lexer) lineStart() bool {
+	i := strings.LastIndexByte(lx.src[:lx.pos], '\n')
+	return strings.TrimSpace(lx.src[i+1:lx.pos]) == "" || strings.TrimSpace(lx.src[i+1:lx.pos]) == "-"
+}
+
+// peek returns the next non-blank character on the current line following
+// position i.
+func (lx *lexer) peek(i int) byte {
+	for ; i < len(lx.src); i++ {
+		if c := lx.src[i]; c != ' ' && c != '\t' {
+			return c
+		}
+	}
+	return 0
+}
+
+func (lx *lexer) isIdentRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune(lx.lang.identChars, r)
+}
+
+// lex tokenizes programming and data languages.
+func (lx *lexer) lex() {
+	l := lx.lang
+	prevIdent := false // True if the previous character was part of an identifier.
+outer:
+	for lx.pos < len(lx.src) {
+		rest := lx.src[lx.pos:]
+		for _, bc := range l.blockComments {
+			if strings.HasPrefix(rest, bc[0]) {
+				lx.emit(Comment, lx.until(lx.pos+len(bc[0]), bc[1]))
+				prevIdent = false
+				continue outer
+			}
+		}
+		for _, lc := range l.lineComments {
+			if strings.HasPrefix(rest, lc) && (lc != "#" || lx.pos == 0 || strings.ContainsRune(" \t\n", rune(lx.src[lx.pos-1]))) {
+				i := strings.IndexByte(rest, '\n')
+				if i == -1 {
+					i = len(rest)
+				}
+				lx.emit(Comment, lx.next(lx.pos+i))
+				prevIdent = false
+				continue outer
+			}
+		}
+		for _, q := range l.multilineStrings {
+			if strings.HasPrefix(rest, q) {
+				lx.emit(String, lx.until(lx.pos+len(q), q))
+				prevIdent = false
+				continue outer
+			}
+		}
+		r, size := utf8.DecodeRuneInString(rest)
+		switch {
+		case strings.ContainsRune(l.quotes, r):
+			start := lx.pos
+			lx.scanString(byte(r))
+			class := String
+			if l.keys == colonKeys && lx.peek(lx.pos) == ':' {
+				class = Attribute
+			}
+			lx.emit(class, lx.src[start:lx.pos])
+		case l.variables && r == '$' && len(rest) > 1:
+			if rest[1] == '{' {
+				lx.emit(Variable, lx.until(lx.pos, "}"))
+			} else {
+				i := 1
+				if strings.ContainsRune("@#?$!*-0123456789", rune(rest[1])) {
+					i = 2 // Special parameter.
+				} else {
+					for i < len(rest) && lx.isIdentRune(rune(rest[i])) {
+						i++
+					}
+				}
+				lx.emit(Variable, lx.next(lx.pos+i))
+			}
+		case !prevIdent && (unicode.IsDigit(r) || (r == '.' && len(rest) > 1 && rest[1] >= '0' && rest[1] <= '9')):
+			lx.emit(Number, lx.next(lx.pos+lx.numberLength(rest)))
+		case r == '#' && l.hexColors && len(rest) > 1 && isHexDigit(rest[1]):
+			i := 1
+			for i < len(rest) && isHexDigit(rest[i]) {
+				i++
+			}
+			lx.emit(Number, lx.next(lx.pos+i))
+		case unicode.IsLetter(r) || r == '_' || (r == '$' && strings.ContainsRune(l.identChars, '$')):
+			i := 0
+			for i < len(rest) {
+				r, size := utf8.DecodeRuneInString(rest[i:])
+				if !lx.isIdentRune(r) {
+					break
+				}
+				i += size
+			}
+			start := lx.pos
+			word := lx.next(lx.pos + i)
+			lx.emit(lx.classify(word, start), word)
+			prevIdent = true
+			continue outer
+		default:
+			switch r {
+			case '{':
+				lx.depth++
+			case '}':
+				lx.depth--
+			}
+			lx.emit("", lx.next(lx.pos+size))
+		}
+		prevIdent = false
+	}
+}
+
+// classify returns the token class of identifier word starting at position
+// start.
+func (lx *lexer) classify(word string, start int) string {
+	l := lx.lang
+	key := word
+	if !l.caseSensitive {
+		key = strings.ToLower(word)
+	}
+	next := lx.peek(lx.pos)
+	switch {
+	case l.keys == colonKeys && next == ':' && (lx.pos+1 >= len(lx.src) || lx.src[lx.pos+1] != ':') && (!l.hexColors || lx.depth > 0):
+		return Attribute
+	case l.keys == equalsKeys && next == '=' && lx.isLineStart(start):
+		return Attribute
+	case l.keywords[key]:
+		return Keyword
+	case l.types[key]:
+		return Type
+	case l.literals[key]:
+		return Literal
+	case next == '(' && !l.hexColors:
+		return Function
+	}
+	return ""
+}
+
+// isLineStart returns true if position i is preceded by only whitespace on its
+// line.
+func (lx *lexer) isLineStart(i int) bool {
+	pos := lx.pos
+	lx.pos = i
+	defer func() { lx.pos = pos }()
+	return lx.lineStart()
+}
+
+// scanString advances past a string literal delimited by quote. Strings that
+// are not terminated end at the end of the line.
+func (lx *lexer) scanString(quote byte) {
+	escapes := !strings.ContainsRune(lx.lang.rawQuotes, rune(quote))
+	for lx.pos++; lx.pos < len(lx.src); lx.pos++ {
+		c := lx.src[lx.pos]
+		switch {
+		case c == '\\' && escapes:
+			lx.pos++
+		case c == quote:
+			lx.pos++
+			return
+		case c == '\n' && !strings.ContainsRune(lx.lang.multilineQuotes, rune(quote)):
+			return
+		}
+	}
+	if lx.pos > len(lx.src) {
+		lx.pos = len(lx.src)
+	}
+}
+
+// numberLength returns the length of the numeric literal at the start of s.
+func (lx *lexer) numberLength(s string) int {
+	hex := strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X")
+	i := 1
+	for ; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= '0' && c <= '9', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_', c == '%':
+		case c == '.' && i+1 < len(s) && s[i+1] >= '0' && s[i+1] <= '9':
+		case (c == '+' || c == '-') && !hex && (s[i-1] == 'e' || s[i-1] == 'E'):
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+// lexMarkup tokenizes HTML and XML.
+func (lx *lexer) lexMarkup() {
+	for lx.pos < len(lx.src) {
+		rest := lx.src[lx.pos:]
+		switch {
+		case strings.HasPrefix(rest, "<!--"):
+			lx.emit(Comment, lx.until(lx.pos+4, "-->"))
+		case strings.HasPrefix(rest, "<![CDATA["):
+			lx.emit(String, lx.until(lx.pos+9, "]]>"))
+		case rest[0] == '<' && len(rest) > 1 && (unicode.IsLetter(rune(rest[1])) || strings.ContainsRune("/?!", rune(rest[1]))):
+			lx.lexTag()
+		default:
+			i := strings.IndexByte(rest[1:], '<')
+			if i == -1 {
+				i = len(rest)
+			} else {
+				i++
+			}
+			lx.emit("", lx.next(lx.pos+i))
+		}
+	}
+}
+
+// lexTag tokenizes a markup tag.
+func (lx *lexer) lexTag() {
+	i := 1
+	for i < len(lx.src)-lx.pos && !strings.ContainsRune(" \t\n/>", rune(lx.src[lx.pos+i])) || i == 1 {
+		i++
+	}
+	lx.emit(Tag, lx.next(lx.pos+i))
+	for lx.pos < len(lx.src) {
+		rest := lx.src[lx.pos:]
+		switch c := rest[0]; {
+		case c == '>' || strings.HasPrefix(rest, "/>") || strings.HasPrefix(rest, "?>"):
+			n := 1
+			if c != '>' {
+				n = 2
+			}
+			lx.emit(Tag, lx.next(lx.pos+n))
+			return
+		case c == '"' || c == '\'':
+			start := lx.pos
+			if i := strings.IndexByte(rest[1:], c); i == -1 {
+				lx.pos = len(lx.src)
+			} else {
+				lx.pos += i + 2
+			}
+			lx.emit(String, lx.src[start:lx.pos])
+		case c == ' ' || c == '\t' || c == '\n' || c == '=':
+			lx.emit("", lx.next(lx.pos+1))
+		default:
+			i := 0
+			for i < len(rest) && !strings.ContainsRune(" \t\n=/>\"'", rune(rest[i])) {
+				i++
+			}
+			if i == 0 {
+				i = 1
+			}
+			lx.emit(Attribute, lx.next(lx.pos+i))
+		}
+	}
+}
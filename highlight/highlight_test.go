@@ -0,0 +1,111 @@
+package highlight
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		lang string
+		code string
+		want string
+	}{
+		{
+			lang: "go",
+			code: "func main() {\n\tfmt.Println(\"<hi>\", 42) // Greet.\n}",
+			want: "<span class=\"hl-k\">func</span> <span class=\"hl-f\">main</span>() {\n\tfmt.<span class=\"hl-f\">Println</span>(<span class=\"hl-s\">&#34;&lt;hi&gt;&#34;</span>, <span class=\"hl-n\">42</span>) <span class=\"hl-c\">// Greet.</span>\n}",
+		},
+		{
+			lang: "Go",
+			code: "var x int = nil /* a\nb */ + 1.5e-3",
+			want: "<span class=\"hl-k\">var</span> x <span class=\"hl-t\">int</span> = <span class=\"hl-l\">nil</span> <span class=\"hl-c\">/* a\nb */</span> + <span class=\"hl-n\">1.5e-3</span>",
+		},
+		{
+			lang: "go",
+			code: "s := `a\\`",
+			want: "s := <span class=\"hl-s\">`a\\`</span>",
+		},
+		{
+			lang: "python",
+			code: "def f(x2):\n    \"\"\"Doc\n    string\"\"\"\n    return None # Comment",
+			want: "<span class=\"hl-k\">def</span> <span class=\"hl-f\">f</span>(x2):\n    <span class=\"hl-s\">&#34;&#34;&#34;Doc\n    string&#34;&#34;&#34;</span>\n    <span class=\"hl-k\">return</span> <span class=\"hl-l\">None</span> <span class=\"hl-c\"># Comment</span>",
+		},
+		{
+			lang: "sh",
+			code: "echo \"$HOME\" $1 ${PATH} a#b # Comment",
+			want: "<span class=\"hl-t\">echo</span> <span class=\"hl-s\">&#34;$HOME&#34;</span> <span class=\"hl-v\">$1</span> <span class=\"hl-v\">${PATH}</span> a#b <span class=\"hl-c\"># Comment</span>",
+		},
+		{
+			lang: "json",
+			code: `{"a": [1, true, "x"]}`,
+			want: "{<span class=\"hl-a\">&#34;a&#34;</span>: [<span class=\"hl-n\">1</span>, <span class=\"hl-l\">true</span>, <span class=\"hl-s\">&#34;x&#34;</span>]}",
+		},
+		{
+			lang: "yaml",
+			code: "title: Hello\n- draft: yes",
+			want: "<span class=\"hl-a\">title</span>: Hello\n- <span class=\"hl-a\">draft</span>: <span class=\"hl-l\">yes</span>",
+		},
+		{
+			lang: "toml",
+			code: "urlprefix = \"/blog\" # Prefix\npaginate = 5",
+			want: "<span class=\"hl-a\">urlprefix</span> = <span class=\"hl-s\">&#34;/blog&#34;</span> <span class=\"hl-c\"># Prefix</span>\n<span class=\"hl-a\">paginate</span> = <span class=\"hl-n\">5</span>",
+		},
+		{
+			lang: "css",
+			code: "a:hover { color: #fff; margin: 0 1.5em; }",
+			want: "a:hover { <span class=\"hl-a\">color</span>: <span class=\"hl-n\">#fff</span>; <span class=\"hl-a\">margin</span>: <span class=\"hl-n\">0</span> <span class=\"hl-n\">1.5em</span>; }",
+		},
+		{
+			lang: "html",
+			code: "<!-- C --><a href=\"x.html\" hidden>A &amp; B</a>",
+			want: "<span class=\"hl-c\">&lt;!-- C --&gt;</span><span class=\"hl-g\">&lt;a</span> <span class=\"hl-a\">href</span>=<span class=\"hl-s\">&#34;x.html&#34;</span> <span class=\"hl-a\">hidden</span><span class=\"hl-g\">&gt;</span>A &amp;amp; B<span class=\"hl-g\">&lt;/a</span><span class=\"hl-g\">&gt;</span>",
+		},
+		{
+			lang: "sql",
+			code: "SELECT * FROM t WHERE id = 'x'",
+			want: "<span class=\"hl-k\">SELECT</span> * <span class=\"hl-k\">FROM</span> t <span class=\"hl-k\">WHERE</span> id = <span class=\"hl-s\">&#39;x&#39;</span>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.lang, func(t *testing.T) {
+			got, ok := Highlight(tt.code, tt.lang)
+			if !ok {
+				t.Fatalf("Highlight() language not supported: %s", tt.lang)
+			}
+			if got != tt.want {
+				t.Errorf("Highlight() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+	if _, ok := Highlight("x", "foobar"); ok {
+		t.Errorf("Highlight() unsupported language ok = true")
+	}
+	// Highlighting preserves the code text (including unterminated tokens).
+	spans := regexp.MustCompile(`</?span[^>]*>`)
+	for _, lang := range Languages() {
+		for _, code := range []string{`"abc`, "/* abc", "<a href='x", "<", "$", "0x", `"""`, "x = 'a\\'", "é-ü: 1"} {
+			got, _ := Highlight(code, lang)
+			if text := html.UnescapeString(spans.ReplaceAllString(got, "")); text != code {
+				t.Errorf("Highlight(%q, %q) = %q", code, lang, got)
+			}
+		}
+	}
+}
+
+func TestCSS(t *testing.T) {
+	for _, name := range Themes() {
+		css, err := CSS(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(css, ".highlight .hl-k { ") {
+			t.Errorf("CSS(%q) = %q", name, css)
+		}
+	}
+	if _, err := CSS("foobar"); err == nil || err.Error() != `illegal highlight theme: "foobar"` {
+		t.Errorf("CSS() error = %v", err)
+	}
+}
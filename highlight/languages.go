@@ -0,0 +1,232 @@
+package highlight
+
+import (
+	"sort"
+	"strings"
+)
+
+// Object key recognition rules.
+const (
+	noKeys     = iota
+	colonKeys  // Names and strings followed by a colon e.g. JSON, YAML.
+	equalsKeys // Names at the start of a line followed by an equals e.g. TOML.
+)
+
+// language describes the lexical syntax of a supported language.
+type language struct {
+	lineComments     []string
+	blockComments    [][2]string
+	quotes           string   // String delimiters.
+	rawQuotes        string   // String delimiters that do not support backslash escapes.
+	multilineQuotes  string   // String delimiters that can span lines.
+	multilineStrings []string // Multi-line string delimiters e.g. Python `"""`.
+	identChars       string   // Non-alphanumeric identifier characters.
+	keywords         map[string]bool
+	types            map[string]bool
+	literals         map[string]bool
+	keys             int
+	caseSensitive    bool
+	variables        bool // Shell `$` variables.
+	hexColors        bool // CSS `#` colors and property keys.
+	markup           bool // HTML and XML.
+}
+
+// words returns a set of space-separated words.
+func words(s string) map[string]bool {
+	result := map[string]bool{}
+	for _, w := range strings.Fields(s) {
+		result[w] = true
+	}
+	return result
+}
+
+var golang = &language{
+	lineComments:    []string{"//"},
+	blockComments:   [][2]string{{"/*", "*/"}},
+	quotes:          "\"'`",
+	rawQuotes:       "`",
+	multilineQuotes: "`",
+	keywords: words(`break case chan const continue default defer else fallthrough for func go goto if
+		import interface map package range return select struct switch type var`),
+	types: words(`any bool byte comparable complex64 complex128 error float32 float64 int int8 int16
+		int32 int64 rune string uint uint8 uint16 uint32 uint64 uintptr append cap close complex copy
+		delete imag len make new panic print println real recover`),
+	literals:      words("true false nil iota"),
+	caseSensitive: true,
+}
+
+var clang = &language{
+	lineComments:  []string{"//"},
+	blockComments: [][2]string{{"/*", "*/"}},
+	quotes:        `"'`,
+	keywords: words(`auto break case class const constexpr continue default delete do else enum
+		explicit extern for friend goto if inline namespace new operator private protected public
+		register return sizeof static struct switch template this throw try catch typedef typename
+		union using virtual volatile while`),
+	types:         words("bool char double float int long short signed unsigned void size_t std string vector"),
+	literals:      words("true false NULL nullptr"),
+	caseSensitive: true,
+}
+
+var java = &language{
+	lineComments:  []string{"//"},
+	blockComments: [][2]string{{"/*", "*/"}},
+	quotes:        `"'`,
+	keywords: words(`abstract assert break case catch class const continue default do else enum extends
+		final finally for goto if implements import instanceof interface native new package private
+		protected public return static strictfp super switch synchronized this throw throws transient
+		try var volatile while record`),
+	types:         words("boolean byte char double float int long short void String Object Integer List Map"),
+	literals:      words("true false null"),
+	caseSensitive: true,
+}
+
+var javascript = &language{
+	lineComments:    []string{"//"},
+	blockComments:   [][2]string{{"/*", "*/"}},
+	quotes:          "\"'`",
+	multilineQuotes: "`",
+	identChars:      "$",
+	keywords: words(`async await break case catch class const continue debugger default delete do else
+		export extends finally for from function if import in instanceof let new of return static super
+		switch this throw try typeof var void while with yield interface type enum implements
+		private protected public readonly declare namespace abstract as`),
+	types: words(`Array Boolean Date Error JSON Map Math Number Object Promise RegExp Set String Symbol
+		console document window any boolean number string unknown never void`),
+	literals:      words("true false null undefined NaN Infinity"),
+	caseSensitive: true,
+}
+
+var python = &language{
+	lineComments:     []string{"#"},
+	quotes:           `"'`,
+	multilineStrings: []string{`"""`, `'''`},
+	keywords: words(`and as assert async await break class continue def del elif else except finally
+		for from global if import in is lambda nonlocal not or pass raise return try while with yield`),
+	types: words(`bool bytes dict float int list object set str tuple abs all any enumerate filter
+		isinstance len map max min open print range repr sorted sum super type zip self`),
+	literals:      words("True False None"),
+	caseSensitive: true,
+}
+
+var rust = &language{
+	lineComments:  []string{"//"},
+	blockComments: [][2]string{{"/*", "*/"}},
+	quotes:        `"`,
+	keywords: words(`as async await break const continue crate dyn else enum extern fn for if impl in
+		let loop match mod move mut pub ref return self Self static struct super trait type unsafe use
+		where while`),
+	types: words(`bool char f32 f64 i8 i16 i32 i64 i128 isize str u8 u16 u32 u64 u128 usize String Vec
+		Option Result Box`),
+	literals:      words("true false None Some Ok Err"),
+	caseSensitive: true,
+}
+
+var shell = &language{
+	lineComments: []string{"#"},
+	quotes:       `"'`,
+	rawQuotes:    `'`,
+	identChars:   "-",
+	keywords: words(`if then else elif fi for while until do done case esac in function return
+		select break continue local export readonly declare unset shift exit`),
+	types: words(`alias cd echo eval exec printf pwd read set source test trap type cat cp curl
+		find git go grep ls make mkdir mv rm sed sudo tar`),
+	variables:     true,
+	caseSensitive: true,
+}
+
+var json = &language{
+	quotes:        `"`,
+	literals:      words("true false null"),
+	keys:          colonKeys,
+	caseSensitive: true,
+}
+
+var yaml = &language{
+	lineComments:  []string{"#"},
+	quotes:        `"'`,
+	identChars:    "-",
+	literals:      words("true false null yes no on off"),
+	keys:          colonKeys,
+	caseSensitive: false,
+}
+
+var toml = &language{
+	lineComments:     []string{"#"},
+	quotes:           `"'`,
+	rawQuotes:        `'`,
+	multilineStrings: []string{`"""`, `'''`},
+	identChars:       "-",
+	literals:         words("true false inf nan"),
+	keys:             equalsKeys,
+	caseSensitive:    true,
+}
+
+var css = &language{
+	blockComments: [][2]string{{"/*", "*/"}},
+	quotes:        `"'`,
+	identChars:    "-",
+	keywords:      words("media import font-face keyframes supports important"),
+	literals:      words("auto inherit initial none unset"),
+	keys:          colonKeys,
+	hexColors:     true,
+}
+
+var sql = &language{
+	lineComments:  []string{"--"},
+	blockComments: [][2]string{{"/*", "*/"}},
+	quotes:        `"'`,
+	keywords: words(`add all alter and as asc begin between by case check column commit constraint
+		create cross database default delete desc distinct drop else end exists foreign from full
+		group having if in index inner insert into is join key left like limit not offset on or
+		order outer primary references right rollback select set table then transaction union
+		unique update values view when where with`),
+	types:    words("bigint blob boolean char date decimal float int integer numeric real text timestamp varchar count sum avg min max"),
+	literals: words("true false null"),
+}
+
+var markup = &language{markup: true}
+
+// languages maps language names and aliases to language definitions.
+var languages = map[string]*language{
+	"go":         golang,
+	"golang":     golang,
+	"c":          clang,
+	"cpp":        clang,
+	"c++":        clang,
+	"h":          clang,
+	"java":       java,
+	"kotlin":     java,
+	"javascript": javascript,
+	"js":         javascript,
+	"typescript": javascript,
+	"ts":         javascript,
+	"python":     python,
+	"py":         python,
+	"rust":       rust,
+	"rs":         rust,
+	"bash":       shell,
+	"sh":         shell,
+	"shell":      shell,
+	"zsh":        shell,
+	"json":       json,
+	"yaml":       yaml,
+	"yml":        yaml,
+	"toml":       toml,
+	"css":        css,
+	"sql":        sql,
+	"html":       markup,
+	"xml":        markup,
+	"svg":        markup,
+}
+
+// Languages returns the sorted names of the supported languages and their
+// aliases.
+func Languages() []string {
+	result := []string{}
+	for name := range languages {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,92 @@
+package highlight
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// theme maps token classes to CSS declarations. The "" entry styles the
+// highlighted code block.
+type theme map[string]string
+
+var themes = map[string]theme{
+	"github": {
+		"":        "color: #24292e; background-color: #f6f8fa;",
+		Comment:   "color: #6a737d; font-style: italic;",
+		Keyword:   "color: #d73a49;",
+		Type:      "color: #005cc5;",
+		Literal:   "color: #005cc5;",
+		String:    "color: #032f62;",
+		Number:    "color: #005cc5;",
+		Function:  "color: #6f42c1;",
+		Attribute: "color: #6f42c1;",
+		Tag:       "color: #22863a;",
+		Variable:  "color: #e36209;",
+	},
+	"monokai": {
+		"":        "color: #f8f8f2; background-color: #272822;",
+		Comment:   "color: #75715e; font-style: italic;",
+		Keyword:   "color: #f92672;",
+		Type:      "color: #66d9ef;",
+		Literal:   "color: #ae81ff;",
+		String:    "color: #e6db74;",
+		Number:    "color: #ae81ff;",
+		Function:  "color: #a6e22e;",
+		Attribute: "color: #a6e22e;",
+		Tag:       "color: #f92672;",
+		Variable:  "color: #fd971f;",
+	},
+	"solarized-light": {
+		"":        "color: #657b83; background-color: #fdf6e3;",
+		Comment:   "color: #93a1a1; font-style: italic;",
+		Keyword:   "color: #859900;",
+		Type:      "color: #b58900;",
+		Literal:   "color: #2aa198;",
+		String:    "color: #2aa198;",
+		Number:    "color: #d33682;",
+		Function:  "color: #268bd2;",
+		Attribute: "color: #268bd2;",
+		Tag:       "color: #268bd2;",
+		Variable:  "color: #cb4b16;",
+	},
+	"solarized-dark": {
+		"":        "color: #839496; background-color: #002b36;",
+		Comment:   "color: #586e75; font-style: italic;",
+		Keyword:   "color: #859900;",
+		Type:      "color: #b58900;",
+		Literal:   "color: #2aa198;",
+		String:    "color: #2aa198;",
+		Number:    "color: #d33682;",
+		Function:  "color: #268bd2;",
+		Attribute: "color: #268bd2;",
+		Tag:       "color: #268bd2;",
+		Variable:  "color: #cb4b16;",
+	},
+}
+
+// Themes returns the sorted names of the CSS themes.
+func Themes() []string {
+	result := []string{}
+	for name := range themes {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// CSS returns the named theme's style sheet. Highlighted code blocks are
+// styled by the `highlight` class.
+func CSS(name string) (string, error) {
+	t, ok := themes[name]
+	if !ok {
+		return "", fmt.Errorf("illegal highlight theme: \"%s\"", name)
+	}
+	var css strings.Builder
+	css.WriteString("/* hindsite " + name + " syntax highlighting theme. */\n")
+	css.WriteString(".highlight { " + t[""] + " }\n")
+	for _, class := range []string{Comment, Keyword, Type, Literal, String, Number, Function, Attribute, Tag, Variable} {
+		css.WriteString(".highlight .hl-" + class + " { " + t[class] + " }\n")
+	}
+	return css.String(), nil
+}
@@ -0,0 +1,182 @@
+package imagex
+
+/*
+Image resizing and encoding using the standard library image codecs.
+*/
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// qualityComment prefixes the JPEG comment that records the encoding quality.
+const qualityComment = "hindsite quality="
+
+// IsJPEG returns true if the file name extension of image file f is a JPEG
+// extension.
+func IsJPEG(f string) bool {
+	switch strings.ToLower(filepath.Ext(f)) {
+	case ".jpg", ".jpeg":
+		return true
+	}
+	return false
+}
+
+// Supported returns true if the file name extension of image file f is a
+// supported image format.
+func Supported(f string) bool {
+	switch strings.ToLower(filepath.Ext(f)) {
+	case ".jpg", ".jpeg", ".png":
+		return true
+	}
+	return false
+}
+
+// Decode decodes a JPEG or PNG image.
+func Decode(r io.Reader) (image.Image, error) {
+	img, _, err := image.Decode(r)
+	return img, err
+}
+
+// DecodeConfig returns the dimensions of a JPEG or PNG image without decoding
+// the entire image.
+func DecodeConfig(r io.Reader) (width, height int, err error) {
+	cfg, _, err := image.DecodeConfig(r)
+	return cfg.Width, cfg.Height, err
+}
+
+// Encode writes the image to w in the format of image file f. quality is the
+// JPEG quality (1 to 100), it is recorded in a JPEG comment (see Quality).
+func Encode(w io.Writer, img image.Image, f string, quality int) error {
+	switch strings.ToLower(filepath.Ext(f)) {
+	case ".jpg", ".jpeg":
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+			return err
+		}
+		// Insert a COM segment after the SOI marker.
+		data := buf.Bytes()
+		comment := qualityComment + strconv.Itoa(quality)
+		n := len(comment) + 2
+		segment := append([]byte{0xFF, 0xFE, byte(n >> 8), byte(n)}, comment...)
+		for _, b := range [][]byte{data[:2], segment, data[2:]} {
+			if _, err := w.Write(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	case ".png":
+		return png.Encode(w, img)
+	}
+	return fmt.Errorf("unsupported image format: \"%s\"", f)
+}
+
+// Quality returns the JPEG quality recorded by Encode in JPEG image data
+// (zero if there is none).
+func Quality(data []byte) int {
+	if len(data) < 6 || !bytes.HasPrefix(data, []byte{0xFF, 0xD8, 0xFF, 0xFE}) {
+		return 0
+	}
+	n := int(data[4])<<8 | int(data[5])
+	if n < 2 || 4+n > len(data) {
+		return 0
+	}
+	comment := string(data[6 : 4+n])
+	if !strings.HasPrefix(comment, qualityComment) {
+		return 0
+	}
+	quality, _ := strconv.Atoi(strings.TrimPrefix(comment, qualityComment))
+	return quality
+}
+
+// Height returns the height of an image of size width x height scaled to
+// width w.
+func Height(width, height, w int) int {
+	h := (height*w + width/2) / width
+	if h < 1 {
+		h = 1
+	}
+	return h
+}
+
+// Resize returns the image scaled to width x height pixels. Each destination
+// pixel is the average of the source pixels it covers.
+func Resize(img image.Image, width, height int) *image.RGBA {
+	src := toRGBA(img)
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for dy := 0; dy < height; dy++ {
+		y0, y1 := span(dy, sh, height)
+		for dx := 0; dx < width; dx++ {
+			x0, x1 := span(dx, sw, width)
+			var r, g, b, a, n int
+			for y := y0; y < y1; y++ {
+				i := src.PixOffset(x0, y)
+				for x := x0; x < x1; x++ {
+					r += int(src.Pix[i])
+					g += int(src.Pix[i+1])
+					b += int(src.Pix[i+2])
+					a += int(src.Pix[i+3])
+					i += 4
+					n++
+				}
+			}
+			i := dst.PixOffset(dx, dy)
+			dst.Pix[i] = uint8((r + n/2) / n)
+			dst.Pix[i+1] = uint8((g + n/2) / n)
+			dst.Pix[i+2] = uint8((b + n/2) / n)
+			dst.Pix[i+3] = uint8((a + n/2) / n)
+		}
+	}
+	return dst
+}
+
+// Thumbnail returns the image scaled and center cropped to width x height
+// pixels.
+func Thumbnail(img image.Image, width, height int) *image.RGBA {
+	b := img.Bounds()
+	crop := b
+	if b.Dx()*height > b.Dy()*width {
+		// Source is wider than the thumbnail.
+		w := b.Dy() * width / height
+		crop.Min.X = b.Min.X + (b.Dx()-w)/2
+		crop.Max.X = crop.Min.X + w
+	} else {
+		h := b.Dx() * height / width
+		crop.Min.Y = b.Min.Y + (b.Dy()-h)/2
+		crop.Max.Y = crop.Min.Y + h
+	}
+	src := image.NewRGBA(image.Rect(0, 0, crop.Dx(), crop.Dy()))
+	draw.Draw(src, src.Bounds(), img, crop.Min, draw.Src)
+	return Resize(src, width, height)
+}
+
+// toRGBA converts the image to a zero origin RGBA image.
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Bounds().Min == (image.Point{}) {
+		return rgba
+	}
+	b := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+	return rgba
+}
+
+// span returns the range of source pixels covered by destination pixel d when
+// n source pixels are scaled to m destination pixels.
+func span(d, n, m int) (int, int) {
+	p0 := d * n / m
+	p1 := (d + 1) * n / m
+	if p1 <= p0 {
+		p1 = p0 + 1
+	}
+	return p0, p1
+}
@@ -0,0 +1,87 @@
+package imagex
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// testImage returns a width x height image with a red left half and a blue
+// right half.
+func testImage(width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.RGBA{255, 0, 0, 255}
+			if x >= width/2 {
+				c = color.RGBA{0, 0, 255, 255}
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestResize(t *testing.T) {
+	img := Resize(testImage(8, 4), 2, 1)
+	if got := img.Bounds().Size(); got != (image.Point{2, 1}) {
+		t.Fatalf("Resize() size = %v", got)
+	}
+	if got := img.RGBAAt(0, 0); got != (color.RGBA{255, 0, 0, 255}) {
+		t.Errorf("Resize() left pixel = %v", got)
+	}
+	if got := img.RGBAAt(1, 0); got != (color.RGBA{0, 0, 255, 255}) {
+		t.Errorf("Resize() right pixel = %v", got)
+	}
+	// Pixels straddling the red/blue boundary are averaged.
+	if got := Resize(testImage(8, 4), 1, 1).RGBAAt(0, 0); got != (color.RGBA{128, 0, 128, 255}) {
+		t.Errorf("Resize() averaged pixel = %v", got)
+	}
+	if got := Height(800, 359, 400); got != 180 {
+		t.Errorf("Height() = %d", got)
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	// The center crop of a wide image is the red/blue boundary.
+	img := Thumbnail(testImage(40, 10), 2, 2)
+	if got := img.Bounds().Size(); got != (image.Point{2, 2}) {
+		t.Fatalf("Thumbnail() size = %v", got)
+	}
+	if got := img.RGBAAt(0, 1); got != (color.RGBA{255, 0, 0, 255}) {
+		t.Errorf("Thumbnail() left pixel = %v", got)
+	}
+	if got := img.RGBAAt(1, 1); got != (color.RGBA{0, 0, 255, 255}) {
+		t.Errorf("Thumbnail() right pixel = %v", got)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	for _, f := range []string{"x.jpg", "x.JPEG", "x.png"} {
+		if !Supported(f) {
+			t.Errorf("Supported(%q) = false", f)
+		}
+		var buf bytes.Buffer
+		if err := Encode(&buf, testImage(8, 4), f, 80); err != nil {
+			t.Fatal(err)
+		}
+		width, height, err := DecodeConfig(bytes.NewReader(buf.Bytes()))
+		if err != nil || width != 8 || height != 4 {
+			t.Errorf("DecodeConfig(%q) = %d, %d, %v", f, width, height, err)
+		}
+		want := 80
+		if !IsJPEG(f) {
+			want = 0
+		}
+		if got := Quality(buf.Bytes()); got != want {
+			t.Errorf("Quality(%q) = %d", f, got)
+		}
+	}
+	if Supported("x.gif") {
+		t.Errorf("Supported(%q) = true", "x.gif")
+	}
+	if err := Encode(&bytes.Buffer{}, testImage(1, 1), "x.gif", 80); err == nil || err.Error() != `unsupported image format: "x.gif"` {
+		t.Errorf("Encode() error = %v", err)
+	}
+}
@@ -0,0 +1,189 @@
+package minify
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// blockTags are HTML elements that are not rendered inline, white space
+// adjacent to their tags is not significant.
+var blockTags = map[string]bool{
+	"!doctype": true, "address": true, "article": true, "aside": true, "base": true,
+	"blockquote": true, "body": true, "br": true, "caption": true, "col": true,
+	"colgroup": true, "dd": true, "details": true, "dialog": true, "div": true,
+	"dl": true, "dt": true, "fieldset": true, "figcaption": true, "figure": true,
+	"footer": true, "form": true, "h1": true, "h2": true, "h3": true, "h4": true,
+	"h5": true, "h6": true, "head": true, "header": true, "hr": true, "html": true,
+	"li": true, "link": true, "main": true, "meta": true, "nav": true, "noscript": true,
+	"ol": true, "option": true, "p": true, "pre": true, "script": true, "section": true,
+	"source": true, "style": true, "summary": true, "table": true, "tbody": true,
+	"td": true, "template": true, "tfoot": true, "th": true, "thead": true,
+	"title": true, "tr": true, "ul": true,
+}
+
+// textTags are SVG text content elements, white space adjacent to their tags
+// is significant.
+var textTags = map[string]bool{
+	"text": true, "tspan": true, "textpath": true,
+}
+
+var spaceRe = regexp.MustCompile(`[ \t\n\r\f]+`)
+
+// HTML removes comments and redundant white space from HTML text. The contents
+// of `pre` and `textarea` elements are not changed, the contents of `script`
+// and `style` elements are minified as JavaScript and CSS. Conditional
+// comments are retained.
+func HTML(text string) (string, error) {
+	return markup(text, false)
+}
+
+// SVG removes comments and white space between elements from SVG text. White
+// space in `text`, `tspan` and `textPath` elements is collapsed.
+func SVG(text string) (string, error) {
+	return markup(text, true)
+}
+
+// tagName returns the lower case name of the tag starting at s[0] (prefixed
+// with "/" if it is a closing tag).
+func tagName(s string) string {
+	i := 1
+	for i < len(s) && !isSpace(s[i]) && s[i] != '>' && !(s[i] == '/' && i > 1) {
+		i++
+	}
+	return strings.ToLower(s[1:i])
+}
+
+// tagEnd returns the index of the closing '>' of the tag starting at s[0].
+func tagEnd(s string) (int, error) {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '"', '\'':
+			j := strings.IndexByte(s[i+1:], s[i])
+			if j == -1 {
+				return 0, fmt.Errorf("unterminated attribute value")
+			}
+			i += j + 1
+		case '>':
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unterminated tag")
+}
+
+// markup minifies HTML or SVG (xml is true) text.
+func markup(text string, xml bool) (string, error) {
+	var b strings.Builder
+	prev := "" // Name of the previous tag.
+	ws := ""   // Pending white space.
+	isBlock := func(name string) bool {
+		if xml {
+			return name != "" && !textTags[strings.TrimPrefix(name, "/")]
+		}
+		return blockTags[strings.TrimPrefix(name, "/")] || strings.HasPrefix(name, "!") || strings.HasPrefix(name, "?")
+	}
+	for i := 0; i < len(text); {
+		s := text[i:]
+		if isSpace(s[0]) {
+			j := 0
+			for j < len(s) && isSpace(s[j]) {
+				j++
+			}
+			ws = " "
+			i += j
+			continue
+		}
+		if s[0] != '<' || len(s) == 1 || !(s[1] == '/' || s[1] == '!' || s[1] == '?' || (s[1] >= 'a' && s[1] <= 'z') || (s[1] >= 'A' && s[1] <= 'Z')) {
+			// Text.
+			j := strings.IndexByte(s[1:], '<')
+			if j == -1 {
+				j = len(s)
+			} else {
+				j++
+			}
+			t := strings.TrimRight(s[:j], " \t\n\r\f")
+			if prev != "" && isBlock(prev) {
+				ws = ""
+			}
+			b.WriteString(ws + spaceRe.ReplaceAllString(t, " "))
+			ws = ""
+			prev = ""
+			i += len(t)
+			continue
+		}
+		switch {
+		case strings.HasPrefix(s, "<!--"):
+			j := strings.Index(s[4:], "-->")
+			if j == -1 {
+				return "", fmt.Errorf("unterminated comment")
+			}
+			j += 7
+			if strings.HasPrefix(s, "<!--[if") || strings.HasPrefix(s, "<!--<![endif]") {
+				b.WriteString(ws + s[:j])
+				ws = ""
+			}
+			i += j
+			continue
+		case strings.HasPrefix(s, "<![CDATA["):
+			j := strings.Index(s, "]]>")
+			if j == -1 {
+				return "", fmt.Errorf("unterminated CDATA section")
+			}
+			b.WriteString(ws + s[:j+3])
+			ws, prev = "", ""
+			i += j + 3
+			continue
+		}
+		name := tagName(s)
+		if ws != "" && !isBlock(prev) && !isBlock(name) {
+			b.WriteString(ws)
+		}
+		ws = ""
+		j, err := tagEnd(s)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(s[:j+1])
+		i += j + 1
+		prev = name
+		switch name {
+		case "pre", "textarea", "script", "style":
+			if strings.HasSuffix(s[:j], "/") {
+				break // Self-closing tag.
+			}
+			k := strings.Index(strings.ToLower(text[i:]), "</"+name)
+			if k == -1 {
+				return "", fmt.Errorf("unterminated %s element", name)
+			}
+			content := text[i : i+k]
+			switch {
+			case name == "script" && isJS(s[:j+1]) && !strings.Contains(content, "<!--"):
+				content, err = JS(content)
+			case name == "style":
+				content, err = CSS(content)
+			}
+			if err != nil {
+				return "", fmt.Errorf("%s element: %s", name, err.Error())
+			}
+			b.WriteString(content)
+			i += k
+		}
+	}
+	return b.String(), nil
+}
+
+var typeAttrRe = regexp.MustCompile(`(?i)\stype\s*=\s*["']?([^"'\s>]+)`)
+
+// isJS returns true if the `script` start tag does not have a non-JavaScript
+// `type` attribute.
+func isJS(tag string) bool {
+	m := typeAttrRe.FindStringSubmatch(tag)
+	if m == nil {
+		return true
+	}
+	switch strings.ToLower(m[1]) {
+	case "text/javascript", "application/javascript", "module":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,323 @@
+package minify
+
+/*
+Conservative HTML, SVG, CSS, JavaScript and JSON minifiers.
+
+The minifiers remove comments and redundant white space, they do not rename or
+restructure code. An error is returned if the text cannot be minified safely.
+*/
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Supported returns true if files with file name extension ext can be
+// minified.
+func Supported(ext string) bool {
+	switch strings.ToLower(ext) {
+	case ".html", ".htm", ".svg", ".css", ".js", ".mjs", ".json":
+		return true
+	}
+	return false
+}
+
+// Minify minifies text in the format of file name extension ext. Text in
+// unsupported formats is returned unchanged.
+func Minify(ext, text string) (string, error) {
+	switch strings.ToLower(ext) {
+	case ".html", ".htm":
+		return HTML(text)
+	case ".svg":
+		return SVG(text)
+	case ".css":
+		return CSS(text)
+	case ".js", ".mjs":
+		return JS(text)
+	case ".json":
+		return JSON(text)
+	}
+	return text, nil
+}
+
+// JSON removes insignificant white space from JSON text.
+func JSON(text string) (string, error) {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, []byte(text)); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+// isIdent returns true if c is a CSS or JavaScript identifier byte (multi-byte
+// UTF-8 characters are treated as identifier bytes).
+func isIdent(c byte) bool {
+	return c == '_' || c == '$' || c == '\\' || c >= 0x80 ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// quoted returns the index of the closing quote of the string literal that
+// starts at s[i].
+func quoted(s string, i int) (int, error) {
+	q := s[i]
+	for j := i + 1; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case q:
+			return j, nil
+		case '\n':
+			return 0, fmt.Errorf("unterminated string")
+		}
+	}
+	return 0, fmt.Errorf("unterminated string")
+}
+
+// CSS removes comments and redundant white space from CSS text.
+func CSS(text string) (string, error) {
+	var b strings.Builder
+	var last byte  // Last byte written.
+	space := false // White space pending.
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c == '/' && strings.HasPrefix(text[i:], "/*"):
+			j := strings.Index(text[i+2:], "*/")
+			if j == -1 {
+				return "", fmt.Errorf("unterminated comment")
+			}
+			i += j + 3
+			space = true
+			continue
+		case isSpace(c):
+			space = true
+			continue
+		}
+		if space && last != 0 && !strings.ContainsRune("{};,>:", rune(last)) && !strings.ContainsRune("{};,>!", rune(c)) {
+			b.WriteByte(' ')
+		}
+		space = false
+		switch c {
+		case '"', '\'':
+			j, err := quoted(text, i)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(text[i : j+1])
+			i = j
+		case '}':
+			if last == ';' {
+				// Drop redundant trailing semicolon.
+				s := b.String()
+				b.Reset()
+				b.WriteString(s[:len(s)-1])
+			}
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+		last = text[i]
+	}
+	return b.String(), nil
+}
+
+// regexpKeywords are JavaScript keywords that can precede a regular expression
+// literal.
+var regexpKeywords = map[string]bool{
+	"return": true, "typeof": true, "instanceof": true, "case": true, "do": true, "else": true,
+	"in": true, "of": true, "new": true, "delete": true, "void": true, "throw": true,
+	"yield": true, "await": true,
+}
+
+// statementKeywords are JavaScript keywords whose parenthesized expression is
+// followed by a statement (which can start with a regular expression literal).
+var statementKeywords = map[string]bool{
+	"if": true, "while": true, "for": true, "with": true,
+}
+
+// regexpPrecedes returns true if a JavaScript regular expression literal (not
+// a division operator) can follow byte c.
+func regexpPrecedes(c byte) bool {
+	return c == 0 || strings.ContainsRune("(,=:[!&|?{};+-*%<>~^", rune(c))
+}
+
+// regexpLiteral returns the index of the last byte (including flags) of the
+// JavaScript regular expression literal that starts at s[i].
+func regexpLiteral(s string, i int) (int, error) {
+	class := false
+	j := i + 1
+	for ; j < len(s); j++ {
+		if s[j] == '\\' {
+			j++
+		} else if s[j] == '[' {
+			class = true
+		} else if s[j] == ']' {
+			class = false
+		} else if s[j] == '/' && !class {
+			break
+		} else if s[j] == '\n' {
+			j = len(s)
+		}
+	}
+	if j >= len(s) {
+		return 0, fmt.Errorf("unterminated regular expression")
+	}
+	for j+1 < len(s) && isIdent(s[j+1]) {
+		j++ // Flags.
+	}
+	return j, nil
+}
+
+// templateLiteral returns the index of the closing backtick of the JavaScript
+// template literal that starts at s[i]. Substitution expressions, including
+// nested literals, are skipped.
+func templateLiteral(s string, i int) (int, error) {
+	for j := i + 1; j < len(s); j++ {
+		switch {
+		case s[j] == '\\':
+			j++
+		case s[j] == '`':
+			return j, nil
+		case strings.HasPrefix(s[j:], "${"):
+			k, err := substitution(s, j+2)
+			if err != nil {
+				return 0, err
+			}
+			j = k
+		}
+	}
+	return 0, fmt.Errorf("unterminated template literal")
+}
+
+// substitution returns the index of the closing brace of the JavaScript
+// template literal substitution expression that starts at s[i].
+func substitution(s string, i int) (int, error) {
+	depth := 0    // Brace nesting depth.
+	var prev byte // Last non-space byte.
+	for j := i; j < len(s); j++ {
+		c := s[j]
+		var err error
+		switch {
+		case isSpace(c):
+			continue
+		case c == '"' || c == '\'':
+			j, err = quoted(s, j)
+		case c == '`':
+			j, err = templateLiteral(s, j)
+		case strings.HasPrefix(s[j:], "//"), strings.HasPrefix(s[j:], "/*"):
+			return 0, fmt.Errorf("comment in template literal substitution")
+		case c == '/' && regexpPrecedes(prev):
+			j, err = regexpLiteral(s, j)
+		case c == '{':
+			depth++
+		case c == '}':
+			if depth == 0 {
+				return j, nil
+			}
+			depth--
+		}
+		if err != nil {
+			return 0, err
+		}
+		prev = s[j]
+	}
+	return 0, fmt.Errorf("unterminated template literal")
+}
+
+// JS removes comments and redundant white space from JavaScript text. Line
+// breaks that could be significant (automatic semicolon insertion) are
+// preserved.
+func JS(text string) (string, error) {
+	var b strings.Builder
+	var last byte      // Last byte written.
+	var word string    // Last identifier written.
+	parens := []bool{} // Open parentheses, true if preceded by a statement keyword.
+	statement := false // Last byte written closes a statement keyword's parentheses.
+	space, nl := false, false
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c == '/' && strings.HasPrefix(text[i:], "//"):
+			j := strings.IndexByte(text[i:], '\n')
+			if j == -1 {
+				j = len(text) - i
+			}
+			i += j - 1
+			space = true
+			continue
+		case c == '/' && strings.HasPrefix(text[i:], "/*"):
+			j := strings.Index(text[i+2:], "*/")
+			if j == -1 {
+				return "", fmt.Errorf("unterminated comment")
+			}
+			if strings.Contains(text[i:i+j+4], "\n") {
+				nl = true
+			}
+			i += j + 3
+			space = true
+			continue
+		case isSpace(c):
+			space = true
+			if c == '\n' {
+				nl = true
+			}
+			continue
+		}
+		if space && last != 0 {
+			switch {
+			case nl && !strings.ContainsRune("{;,([", rune(last)) && !strings.ContainsRune("})];,.", rune(c)):
+				b.WriteByte('\n')
+			case isIdent(last) && isIdent(c), (last == '+' || last == '-') && c == last, last == '/' && c == '/':
+				b.WriteByte(' ')
+			}
+		}
+		space, nl = false, false
+		start := i
+		switch {
+		case c == '"' || c == '\'':
+			j, err := quoted(text, i)
+			if err != nil {
+				return "", err
+			}
+			i = j
+		case c == '`':
+			j, err := templateLiteral(text, i)
+			if err != nil {
+				return "", err
+			}
+			i = j
+		case c == '/' && (regexpPrecedes(last) || (isIdent(last) && regexpKeywords[word]) || (last == ')' && statement)):
+			j, err := regexpLiteral(text, i)
+			if err != nil {
+				return "", err
+			}
+			i = j
+		case c == '(':
+			parens = append(parens, isIdent(last) && statementKeywords[word])
+		case c == ')':
+			statement = false
+			if n := len(parens); n > 0 {
+				statement = parens[n-1]
+				parens = parens[:n-1]
+			}
+		case isIdent(c):
+			for i+1 < len(text) && isIdent(text[i+1]) {
+				i++
+			}
+		}
+		b.WriteString(text[start : i+1])
+		last = text[i]
+		if isIdent(c) {
+			word = text[start : i+1]
+		} else {
+			word = ""
+		}
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,126 @@
+package minify
+
+import (
+	"testing"
+)
+
+func TestCSS(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"body {\n  color: red;\n  margin: 0 auto;\n}\n", "body{color:red;margin:0 auto}"},
+		{"/* Comment. */\na > b, c :hover { width: calc(100% - 2px) !important; }", "a>b,c :hover{width:calc(100% - 2px)!important}"},
+		{`p::before { content: "a  /* b */  c"; }`, `p::before{content:"a  /* b */  c"}`},
+	}
+	for _, tt := range tests {
+		got, err := CSS(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("CSS(%q) = %q, %v, want %q", tt.in, got, err, tt.want)
+		}
+	}
+	if _, err := CSS("p { color: red; } /* Unterminated"); err == nil {
+		t.Errorf("CSS() unterminated comment: expected error")
+	}
+}
+
+func TestJS(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"// Comment.\nvar a = 1;\nvar b = a + +1;\n", "var a=1;var b=a+ +1;"},
+		{"function f(x) {\n  /* Comment. */\n  return x\n}\nf(2)\n", "function f(x){return x}\nf(2)"},
+		{"var s = 'a // b', r = /\\/* c/g;\nx = a / b / c", "var s='a // b',r=/\\/* c/g;x=a/b/c"},
+		{"return /[/]/.test(s)", "return/[/]/.test(s)"},
+		{"var t = `a\n  b`;", "var t=`a\n  b`;"},
+		{"var t = `a ${ `b  c` } d`;", "var t=`a ${ `b  c` } d`;"},
+		{"var t = `${ {a: '}'}.a }  ${ x / 2 }  ${ /`/.test(s) }`;", "var t=`${ {a: '}'}.a }  ${ x / 2 }  ${ /`/.test(s) }`;"},
+		{"if (x) /a  b/.test(s)", "if(x)/a  b/.test(s)"},
+		{"y = (a + b) / 2 / c", "y=(a+b)/2/c"},
+		{"while (f(x)) /a  b/.test(s)", "while(f(x))/a  b/.test(s)"},
+	}
+	for _, tt := range tests {
+		got, err := JS(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("JS(%q) = %q, %v, want %q", tt.in, got, err, tt.want)
+		}
+	}
+	if _, err := JS("var s = 'unterminated;\n"); err == nil {
+		t.Errorf("JS() unterminated string: expected error")
+	}
+	if _, err := JS("var t = `a ${ b // }\n }`;"); err == nil {
+		t.Errorf("JS() template literal substitution comment: expected error")
+	}
+	if _, err := JS("var t = `a ${ `b } c`;"); err == nil {
+		t.Errorf("JS() unterminated template literal: expected error")
+	}
+}
+
+func TestHTML(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{
+			"<!DOCTYPE html>\n<html>\n  <head>\n    <!-- Comment -->\n    <title>Hello  World</title>\n  </head>\n  <body>\n    <p>Hello <em>big</em> <b>world</b> </p>\n  </body>\n</html>\n",
+			"<!DOCTYPE html><html><head><title>Hello World</title></head><body><p>Hello <em>big</em> <b>world</b></p></body></html>",
+		},
+		{
+			"<div>\n<pre>  a\n  b</pre>\n<textarea> x </textarea>\n</div>",
+			"<div><pre>  a\n  b</pre><textarea> x </textarea></div>",
+		},
+		{
+			"<script>\n  var a = 1; // Comment.\n</script>\n<style>\n  p { color: red; }\n</style>",
+			"<script>var a=1;</script><style>p{color:red}</style>",
+		},
+		{
+			"<script type=\"text/x-template\">\n  <p> x </p>\n</script>",
+			"<script type=\"text/x-template\">\n  <p> x </p>\n</script>",
+		},
+		{
+			"<!--[if IE]><p>IE</p><![endif]-->\n<p title=\"a > b\">1 < 2</p>",
+			"<!--[if IE]><p>IE</p><![endif]--><p title=\"a > b\">1 < 2</p>",
+		},
+	}
+	for _, tt := range tests {
+		got, err := HTML(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("HTML(%q) = %q, %v, want %q", tt.in, got, err, tt.want)
+		}
+	}
+	for _, in := range []string{"<p>Unterminated <!-- comment", "<p title=\"unterminated>", "<pre>Unterminated"} {
+		if _, err := HTML(in); err == nil {
+			t.Errorf("HTML(%q): expected error", in)
+		}
+	}
+}
+
+func TestSVG(t *testing.T) {
+	in := "<?xml version=\"1.0\"?>\n<!-- Comment -->\n<svg xmlns=\"http://www.w3.org/2000/svg\">\n  <g>\n    <text>Hello  World</text>\n  </g>\n</svg>\n"
+	want := "<?xml version=\"1.0\"?><svg xmlns=\"http://www.w3.org/2000/svg\"><g><text>Hello World</text></g></svg>"
+	got, err := SVG(in)
+	if err != nil || got != want {
+		t.Errorf("SVG() = %q, %v, want %q", got, err, want)
+	}
+	// White space in text content elements is significant.
+	in = "<svg>\n  <text>Hello <tspan>World</tspan> <textPath href=\"#p\">and\n  more</textPath></text>\n</svg>"
+	want = "<svg><text>Hello <tspan>World</tspan> <textPath href=\"#p\">and more</textPath></text></svg>"
+	got, err = SVG(in)
+	if err != nil || got != want {
+		t.Errorf("SVG() = %q, %v, want %q", got, err, want)
+	}
+}
+
+func TestMinify(t *testing.T) {
+	got, err := Minify(".JSON", "{\n  \"a\": [1, 2],\n  \"b\": \"c d\"\n}\n")
+	if err != nil || got != `{"a":[1,2],"b":"c d"}` {
+		t.Errorf("Minify(.json) = %q, %v", got, err)
+	}
+	if _, err := Minify(".json", "{"); err == nil {
+		t.Errorf("Minify(.json): expected error")
+	}
+	if got, err := Minify(".txt", " a  b "); err != nil || got != " a  b " {
+		t.Errorf("Minify(.txt) = %q, %v", got, err)
+	}
+	if Supported(".txt") || !Supported(".css") {
+		t.Errorf("Supported() returned incorrect result")
+	}
+}
@@ -0,0 +1,218 @@
+package site
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"sort"
+	"time"
+
+	"github.com/srackham/hindsite/v2/fsx"
+)
+
+// Options configures a Site opened with Open. Zero values select the same
+// defaults as the corresponding hindsite command-line options.
+type Options struct {
+	SiteDir     string    // Site directory (-site option).
+	ContentDir  string    // Content directory (-content option).
+	TemplateDir string    // Template directory (-template option).
+	BuildDir    string    // Build directory (-build option).
+	Vars        []string  // Configuration variable NAME=VALUE assignments (-var options).
+	ConfigFiles []string  // Configuration files merged into the root configuration (-config options).
+	Drafts      bool      // Include draft documents (-drafts option).
+	Future      bool      // Include future dated documents (-future option).
+	Lint        bool      // Validate generated HTML (-lint option).
+	Keep        bool      // Do not delete the build directory contents (-keep option).
+	Incremental bool      // Only rebuild changed files (-incremental option).
+	Jobs        int       // Number of concurrent renderers (-jobs option).
+	HTTPPort    uint16    // Serve HTTP port (-port option).
+	LRPort      uint16    // Serve LiveReload port (-port option).
+	NoReload    bool      // Disable serve LiveReload (-port option).
+	Navigate    bool      // Serve navigates to new and updated documents (-navigate option).
+	Launch      bool      // Serve launches the site in the default browser (-launch option).
+	Verbosity   int       // Log output verbosity (-v options).
+	Log         io.Writer // Log output destination (nil discards log output).
+	// Print log output, errors and warnings to the console and read Serve
+	// keyboard commands from stdin, like the hindsite command (Log is ignored).
+	Console bool
+	// Alternative content and template directory file systems e.g. an
+	// embed.FS or a fstest.MapFS. Content and template directory paths are
+	// mapped to the root of their file system and need not exist.
+	ContentFS  fs.FS
+	TemplateFS fs.FS
+	// Build output file system (nil writes to the build directory on disk)
+	// e.g. fsx.NewMemoryOutput().
+	Output fsx.Output
+}
+
+// Site is a hindsite site that can be built and served programmatically.
+// Errors and warnings are returned in build results (they are only printed if
+// the Console option is set).
+type Site struct {
+	site *site
+}
+
+// Diagnostic is a build error or warning message.
+type Diagnostic struct {
+	Path    string // The file the message refers to (blank if not file specific).
+	Message string
+}
+
+// Document describes a built document.
+type Document struct {
+	ContentPath string    // Source file path.
+	BuildPath   string    // Generated webpage file path.
+	URL         string    // Document URL.
+	Title       string    // Document title.
+	Date        time.Time // Publication date.
+	Tags        []string  // Document tags.
+	// Taxonomy terms keyed by configured taxonomy name (excluding tags).
+	Terms map[string][]string
+}
+
+// DocumentResult is the build result for a document.
+type DocumentResult struct {
+	Document
+	Errors   []Diagnostic // Errors attributed to the document.
+	Warnings []Diagnostic // Warnings attributed to the document.
+}
+
+// BuildResult is the result of a site build.
+type BuildResult struct {
+	Documents []DocumentResult // Built documents sorted by content path.
+	Errors    []Diagnostic     // All non-fatal build errors.
+	Warnings  []Diagnostic     // All build warnings.
+	Duration  time.Duration    // Build time.
+}
+
+// Open validates the site options and returns a Site.
+func Open(opts Options) (*Site, error) {
+	site := New()
+	site.silent = !opts.Console
+	site.log = opts.Log
+	site.siteDir = opts.SiteDir
+	site.contentDir = opts.ContentDir
+	site.templateDir = opts.TemplateDir
+	site.buildDir = opts.BuildDir
+	site.contentFS = opts.ContentFS
+	site.templateFS = opts.TemplateFS
+	if opts.Output != nil {
+		site.buildFS = opts.Output
+	}
+	site.drafts = opts.Drafts
+	site.future = opts.Future
+	site.lint = opts.Lint
+	site.keep = opts.Keep
+	site.incremental = opts.Incremental
+	if opts.Jobs > 0 {
+		site.jobs = opts.Jobs
+	}
+	if opts.HTTPPort != 0 {
+		site.httpport = opts.HTTPPort
+	}
+	if opts.LRPort != 0 {
+		site.lrport = opts.LRPort
+	}
+	site.livereload = !opts.NoReload
+	site.navigate = opts.Navigate
+	site.launch = opts.Launch
+	site.verbosity = opts.Verbosity
+	for _, v := range opts.Vars {
+		if err := site.vars.parseVar(v); err != nil {
+			return nil, err
+		}
+	}
+	for _, f := range opts.ConfigFiles {
+		if err := site.vars.parseConfigFile(f); err != nil {
+			return nil, err
+		}
+	}
+	if err := site.setDirs(); err != nil {
+		return nil, err
+	}
+	return &Site{site: &site}, nil
+}
+
+// Build builds the site. The returned error is only non-nil if the build
+// failed; non-fatal errors and warnings are returned in the build result.
+// Canceling the context stops the build.
+func (s *Site) Build(ctx context.Context) (*BuildResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.site.command = "build"
+	s.site.ctx = ctx
+	defer func() { s.site.ctx = nil }()
+	start := time.Now()
+	err := s.site.build()
+	if err != nil && err != ErrNonFatal {
+		return nil, err
+	}
+	result := &BuildResult{
+		Errors:   s.site.errorLog,
+		Warnings: s.site.warningLog,
+		Duration: time.Since(start),
+	}
+	for _, doc := range s.Documents() {
+		dr := DocumentResult{Document: doc}
+		for _, d := range result.Errors {
+			if d.Path == doc.ContentPath {
+				dr.Errors = append(dr.Errors, d)
+			}
+		}
+		for _, d := range result.Warnings {
+			if d.Path == doc.ContentPath {
+				dr.Warnings = append(dr.Warnings, d)
+			}
+		}
+		result.Documents = append(result.Documents, dr)
+	}
+	return result, nil
+}
+
+// Documents returns the documents from the most recent build sorted by content
+// path.
+func (s *Site) Documents() []Document {
+	result := []Document{}
+	for _, doc := range s.site.docs.byContentPath {
+		terms := map[string][]string{}
+		for _, t := range doc.conf.taxonomies {
+			if ts := doc.taxonomyTerms(t); len(ts) > 0 {
+				terms[t.name] = append([]string{}, ts...)
+			}
+		}
+		result = append(result, Document{
+			ContentPath: doc.contentPath,
+			BuildPath:   doc.buildPath,
+			URL:         doc.url,
+			Title:       doc.title,
+			Date:        doc.date,
+			Tags:        append([]string{}, doc.tags...),
+			Terms:       terms,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ContentPath < result[j].ContentPath
+	})
+	return result
+}
+
+// Serve builds the site then serves it, rebuilding the site when content or
+// template files change. Serve does not return until the context is canceled
+// or a server error occurs.
+func (s *Site) Serve(ctx context.Context) error {
+	if _, ok := s.site.buildFS.(fsx.DiskOutput); !ok || s.site.contentFS != nil || s.site.templateFS != nil {
+		return fmt.Errorf("serve requires content, template and build directories on disk")
+	}
+	s.site.command = "serve"
+	svr := newServer(s.site)
+	go func() {
+		select {
+		case <-ctx.Done():
+			svr.close(nil)
+		case <-svr.quit:
+		}
+	}()
+	return svr.serve()
+}
@@ -0,0 +1,188 @@
+package site
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/srackham/hindsite/v2/assert"
+	"github.com/srackham/hindsite/v2/fsx"
+)
+
+func TestAPI(t *testing.T) {
+	tmpdir := initTestSite(t, "hindsite-api-tests")
+
+	_, err := Open(Options{SiteDir: filepath.Join(tmpdir, "missing")})
+	assert.Contains(t, err.Error(), "missing site directory: ")
+	_, err = Open(Options{SiteDir: tmpdir, Vars: []string{"foobar"}})
+	assert.Equal(t, `illegal -var syntax: "foobar"`, err.Error())
+
+	s, err := Open(Options{SiteDir: tmpdir, Vars: []string{"author=Bill Blow"}})
+	assert.True(t, err == nil)
+	assert.Equal(t, 0, len(s.Documents()))
+	result, err := s.Build(context.Background())
+	assert.True(t, err == nil)
+	assert.Equal(t, 10, len(result.Documents))
+	assert.Equal(t, 0, len(result.Errors))
+	assert.Equal(t, 6, len(result.Warnings))
+	docs := s.Documents()
+	assert.Equal(t, 10, len(docs))
+	var doc DocumentResult
+	for _, dr := range result.Documents {
+		if strings.HasSuffix(dr.ContentPath, "2016-12-16-newsletter.md") {
+			doc = dr
+		}
+	}
+	assert.Equal(t, 1, len(doc.Warnings))
+	assert.Equal(t, `unhygienic document URL path: "/newsletters/slug with spaces.html"`, doc.Warnings[0].Message)
+	assert.True(t, fsx.FileExists(doc.BuildPath))
+	html, _ := fsx.ReadFile(filepath.Join(tmpdir, "build", "about.html"))
+	assert.Contains(t, html, ".author=Bill Blow")
+
+	// Non-fatal errors are attributed to documents.
+	f := filepath.Join(tmpdir, "content", "posts", "bad.md")
+	fsx.WriteFile(f, "---\ndate: foobar\n---\n")
+	result, err = s.Build(context.Background())
+	assert.True(t, err == nil)
+	assert.Equal(t, 1, len(result.Errors))
+	assert.Equal(t, f, result.Errors[0].Path)
+	assert.Contains(t, result.Errors[0].Message, `illegal date value: "foobar"`)
+	os.Remove(f)
+
+	// API builds are equivalent to the build command.
+	s2, err := Open(Options{SiteDir: tmpdir, Vars: []string{"fingerprint=*.css"}})
+	assert.True(t, err == nil)
+	_, err = s2.Build(context.Background())
+	assert.True(t, err == nil)
+	assert.True(t, fsx.FileExists(filepath.Join(tmpdir, "build", fingerprintManifest)))
+
+	// The build command reports non-fatal errors.
+	fsx.WriteFile(f, "---\ndate: foobar\n---\n")
+	_, err = execute("hindsite build -site " + tmpdir)
+	assert.True(t, err == ErrNonFatal)
+	os.Remove(f)
+
+	// Canceled builds.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = s.Build(ctx)
+	assert.True(t, err == context.Canceled)
+
+	// Serve until the context is canceled.
+	s, err = Open(Options{SiteDir: tmpdir, HTTPPort: 1214, NoReload: true})
+	assert.True(t, err == nil)
+	ctx, cancel = context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- s.Serve(ctx)
+	}()
+	var body string
+	for i := 0; i < 50; i++ {
+		time.Sleep(20 * time.Millisecond)
+		if resp, err := http.Get("http://localhost:1214/about.html"); err == nil {
+			b, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			body = string(b)
+			break
+		}
+	}
+	assert.Contains(t, body, "About Test")
+	cancel()
+	select {
+	case err = <-done:
+		assert.True(t, err == nil)
+	case <-time.After(2 * time.Second):
+		t.Fatal("serve did not stop")
+	}
+	// Serve goroutines, including the keyboard monitor, exit when serving stops.
+	stopped := false
+	for i := 0; i < 50 && !stopped; i++ {
+		time.Sleep(20 * time.Millisecond)
+		buf := make([]byte, 1<<20)
+		stopped = !strings.Contains(string(buf[:runtime.Stack(buf, true)]), "(*server).serve.func")
+	}
+	assert.True(t, stopped)
+}
+
+func TestFileSystems(t *testing.T) {
+	tmpdir := filepath.Join(os.TempDir(), "hindsite-fs-tests")
+	os.RemoveAll(tmpdir)
+	fsx.MkMissingDir(tmpdir)
+	contentDir := filepath.Join(tmpdir, "content")
+	buildDir := filepath.Join(tmpdir, "build")
+
+	// Build the test blog from OS directory file systems to memory.
+	out := fsx.NewMemoryOutput()
+	s, err := Open(Options{
+		SiteDir:    tmpdir,
+		ContentFS:  os.DirFS("./testdata/blog/template/init"),
+		TemplateFS: os.DirFS("./testdata/blog/template"),
+		Output:     out,
+	})
+	assert.True(t, err == nil)
+	result, err := s.Build(context.Background())
+	assert.True(t, err == nil)
+	assert.Equal(t, 10, len(result.Documents))
+	assert.Equal(t, 0, len(result.Errors))
+	assert.Equal(t, filepath.Join(contentDir, "about.md"), result.Documents[0].ContentPath)
+	assert.Contains(t, out.Text(filepath.Join(buildDir, "about.html")), "<title>About Test</title>")
+	assert.True(t, out.FileExists(filepath.Join(buildDir, "main.css")))
+	assert.True(t, out.FileExists(filepath.Join(buildDir, "indexes", "posts", "docs-1.html")))
+	assert.False(t, fsx.DirExists(contentDir))
+	assert.False(t, fsx.DirExists(buildDir))
+	err = s.Serve(context.Background())
+	assert.Equal(t, "serve requires content, template and build directories on disk", err.Error())
+
+	// Incremental builds skip unchanged files.
+	s, _ = Open(Options{
+		SiteDir:     tmpdir,
+		ContentFS:   os.DirFS("./testdata/blog/template/init"),
+		TemplateFS:  os.DirFS("./testdata/blog/template"),
+		Output:      out,
+		Incremental: true,
+		Verbosity:   2,
+	})
+	_, err = s.Build(context.Background())
+	assert.True(t, err == nil)
+	assert.True(t, out.FileExists(filepath.Join(buildDir, cacheFile)))
+	var log strings.Builder
+	s.site.log = &log
+	_, err = s.Build(context.Background())
+	assert.True(t, err == nil)
+	assert.Contains(t, log.String(), "skip unchanged: \""+filepath.Join(contentDir, "about.md")+"\"")
+
+	// Build a site from in-memory file systems.
+	out = fsx.NewMemoryOutput()
+	s, err = Open(Options{
+		SiteDir: tmpdir,
+		ContentFS: fstest.MapFS{
+			"index.md":       {Data: []byte("---\ntitle: Home\n---\nHello *World*")},
+			"posts/post1.md": {Data: []byte("# Post 1")},
+			"robots.txt":     {Data: []byte("User-agent: *")},
+		},
+		TemplateFS: fstest.MapFS{
+			"config.toml":     {Data: []byte("urlprefix = \"http://example.com\"\nsitemap = true\nhomepage = \"index.html\"")},
+			"layout.html":     {Data: []byte("<title>{{.title}}</title>{{.body}}{{.data.site.name}}")},
+			"posts/docs.html": {Data: []byte("{{range .docs}}{{.title}}{{end}}")},
+			"data/site.yaml":  {Data: []byte("name: Test")},
+		},
+		Output: out,
+	})
+	assert.True(t, err == nil)
+	result, err = s.Build(context.Background())
+	assert.True(t, err == nil)
+	assert.Equal(t, 2, len(result.Documents))
+	assert.Equal(t, 0, len(result.Errors))
+	assert.Equal(t, "<title>Home</title><p>Hello <em>World</em></p>\nTest", out.Text(filepath.Join(buildDir, "index.html")))
+	assert.Equal(t, "Post1", out.Text(filepath.Join(buildDir, "indexes", "posts", "docs-1.html")))
+	assert.Equal(t, "User-agent: *", out.Text(filepath.Join(buildDir, "robots.txt")))
+	assert.Contains(t, out.Text(filepath.Join(buildDir, "sitemap.xml")), "<loc>http://example.com/</loc>")
+	assert.Equal(t, 5, len(out.Files(buildDir)))
+}
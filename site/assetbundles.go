@@ -0,0 +1,77 @@
+package site
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+/*
+An asset bundle is a CSS or JavaScript build file that is the concatenation of
+one or more content directory source files. Asset bundles are configured with
+the root configuration `bundles` variable. Bundle source files are not copied
+to the build directory.
+*/
+
+// assetBundlesOf returns the asset bundles that content file f is a source of.
+func (site *site) assetBundlesOf(f string) (result []assetBundle) {
+	for _, b := range site.confs[0].bundles {
+		for _, src := range b.sources {
+			if f == filepath.Join(site.contentDir, filepath.FromSlash(src)) {
+				result = append(result, b)
+				break
+			}
+		}
+	}
+	return
+}
+
+// bundlePath returns the (unfingerprinted) build path of the asset bundle.
+func (site *site) bundlePath(b assetBundle) string {
+	return filepath.Join(site.buildDir, filepath.FromSlash(b.name))
+}
+
+// buildAssetBundle concatenates the asset bundle source files and writes them
+// to the build directory. The bundle is minified and fingerprinted if the
+// `minify` and `fingerprint` configuration variables apply.
+func (site *site) buildAssetBundle(b assetBundle) error {
+	separator := "\n"
+	if filepath.Ext(b.name) == ".js" {
+		separator = ";\n" // Guard against sources that rely on automatic semicolon insertion.
+	}
+	var text strings.Builder
+	for _, src := range b.sources {
+		f := filepath.Join(site.contentDir, filepath.FromSlash(src))
+		site.logVerbose2("read bundle source: \"%s\"", f)
+		contents, err := site.vfs(f).ReadFile(f)
+		if err != nil {
+			return fmt.Errorf("bundle: \"%s\": %s", b.name, err.Error())
+		}
+		if text.Len() > 0 {
+			text.WriteString(separator)
+		}
+		text.WriteString(strings.TrimRight(contents, "\n"))
+	}
+	text.WriteString("\n")
+	dst := site.bundlePath(b)
+	contents := site.minify(dst, text.String())
+	dst = site.fingerprintPath(filepath.Join(site.contentDir, filepath.FromSlash(b.name)), dst, contents)
+	site.logVerbose("write bundle: \"%s\"", dst)
+	if err := site.buildFS.WriteFile(dst, []byte(contents)); err != nil {
+		return err
+	}
+	if site.incremental {
+		site.record(site.cache.Static, b.name, hashOf(contents), dst)
+	}
+	return nil
+}
+
+// buildAssetBundles writes all asset bundles to the build directory. Bundle
+// errors are logged as non-fatal errors.
+func (site *site) buildAssetBundles() {
+	for _, b := range site.confs[0].bundles {
+		if err := site.buildAssetBundle(b); err != nil {
+			site.logError(err.Error())
+		}
+	}
+}
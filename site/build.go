@@ -3,12 +3,15 @@ package site
 import (
 	"errors"
 	"fmt"
+	"html/template"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sync"
 	"time"
 
 	"github.com/srackham/hindsite/v2/fsx"
+	"github.com/srackham/hindsite/v2/minify"
 )
 
 var ErrNonFatal = errors.New("recoverable build errors")
@@ -18,63 +21,81 @@ func (site *site) build() error {
 	if len(site.cmdargs) > 0 {
 		return fmt.Errorf("to many command arguments")
 	}
-	site.errors = 0
-	site.warnings = 0
+	site.resetLogs()
 	startTime := time.Now()
 	if err := site.parseConfigFiles(); err != nil {
 		return err
 	}
+	if err := site.loadData(); err != nil {
+		return err
+	}
 	site.docs = newDocumentsLookup()
+	site.upcoming = nil
+	site.fingerprints = map[string]string{}
+	site.images = map[string]imageInfo{}
 	// Parse all template files.
-	site.htmlTemplates = newHTMLTemplates(site.templateDir)
-	site.textTemplates = newTextTemplates(site.templateDir)
-	err := filepath.Walk(site.templateDir, func(f string, info os.FileInfo, err error) error {
+	funcs := site.templateFuncs()
+	site.htmlTemplates = newHTMLTemplates(site.templateDir, funcs)
+	site.textTemplates = newTextTemplates(site.templateDir, funcs)
+	vfs := site.vfs(site.templateDir)
+	err := vfs.Walk(site.templateDir, func(f string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 		if f == site.templateDir {
 			return nil
 		}
-		if info.IsDir() && f == site.initDir {
+		if info.IsDir() && (f == site.initDir || f == site.dataDir) {
 			return filepath.SkipDir
 		}
-		if !info.IsDir() {
-			switch filepath.Ext(f) {
-			case ".toml", ".yaml":
-				// Skip configuration file.
-			case ".html":
-				// Compile HTML template.
-				site.logVerbose("parse template: \"%s\"", f)
-				err = site.htmlTemplates.add(f)
-			case ".txt":
-				// Compile text template.
-				site.logVerbose("parse template: \"%s\"", f)
-				err = site.textTemplates.add(f)
-			}
+		if info.IsDir() {
+			return nil
 		}
-		return err
+		ext := filepath.Ext(f)
+		if ext != ".html" && ext != ".txt" && filepath.Base(f) != "feed.xml" {
+			return nil // Skip configuration and other non-template files.
+		}
+		site.logVerbose("parse template: \"%s\"", f)
+		text, err := vfs.ReadFile(f)
+		if err != nil {
+			return err
+		}
+		if ext == ".html" {
+			// Compile HTML template.
+			return site.htmlTemplates.add(f, text)
+		}
+		// Compile text or feed template.
+		return site.textTemplates.add(f, text)
 	})
 	if err != nil {
 		return err
 	}
-	if !fsx.DirExists(site.buildDir) {
-		if err := os.Mkdir(site.buildDir, 0775); err != nil {
+	if err := site.buildFS.MkdirAll(site.buildDir); err != nil {
+		return err
+	}
+	// Load the previous build cache. The cache is discarded if any site-wide
+	// inputs have changed.
+	prevCache := newBuildCache()
+	if site.incremental {
+		prevCache = site.loadCache()
+		site.cache = newBuildCache()
+		if site.cache.Hash, err = site.siteHash(); err != nil {
 			return err
 		}
+		if prevCache.Hash != site.cache.Hash {
+			site.logVerbose("site configuration or templates changed: full rebuild")
+		}
 	}
 	// Delete everything in the build directory forcing a complete site rebuild.
-	if !site.keep {
-		files, _ := filepath.Glob(filepath.Join(site.buildDir, "*"))
-		for _, f := range files {
-			if err := os.RemoveAll(f); err != nil {
-				return err
-			}
+	if !site.keep && !site.incremental {
+		if err := site.buildFS.Clear(site.buildDir); err != nil {
+			return err
 		}
 	}
 	// Parse content directory documents and copy/render static files to the build directory.
 	docsCount := 0
 	staticCount := 0
-	err = filepath.Walk(site.contentDir, func(f string, info os.FileInfo, err error) error {
+	err = site.vfs(site.contentDir).Walk(site.contentDir, func(f string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
@@ -98,8 +119,11 @@ func (site *site) build() error {
 					site.logError(err.Error())
 					return nil
 				}
-				if doc.isDraft() {
-					site.logVerbose("skip draft: \"%s\"", f)
+				if reason := doc.skipReason(); reason != "" {
+					site.logVerbose("skip %s: \"%s\"", reason, f)
+					if reason == "future" {
+						site.upcoming = append(site.upcoming, &doc)
+					}
 					return nil
 				}
 				if err := site.docs.add(&doc); err != nil {
@@ -108,10 +132,40 @@ func (site *site) build() error {
 				}
 			default:
 				staticCount++
+				if site.bundleIndex(f) != "" {
+					// Page bundle resources are copied with the bundle document.
+					return nil
+				}
+				if len(site.assetBundlesOf(f)) > 0 {
+					// Asset bundle sources are written to their bundles.
+					return nil
+				}
+				var key, hash string
+				if site.incremental {
+					key = relPath(f, site.contentDir)
+					hash = site.staticHash(f, info)
+					if site.cached(prevCache.Static, site.cache.Static, key, hash) {
+						site.logVerbose2("skip unchanged: \"%s\"", f)
+						if site.isFingerprinted(f) {
+							// The fingerprinted build file is the first cached output.
+							fp := filepath.Join(site.buildDir, filepath.FromSlash(site.cache.Static[key].Outputs[0]))
+							site.setFingerprint(fsx.PathTranslate(f, site.contentDir, site.buildDir), fp)
+						}
+						return nil
+					}
+				}
 				if err := site.buildStaticFile(f); err != nil {
 					site.logError(err.Error())
 					return nil
 				}
+				if site.incremental {
+					outputs := []string{site.fingerprintedPath(fsx.PathTranslate(f, site.contentDir, site.buildDir))}
+					derivatives, _, _ := site.imageDerivatives(f)
+					for _, d := range derivatives {
+						outputs = append(outputs, d.buildPath)
+					}
+					site.record(site.cache.Static, key, hash, outputs...)
+				}
 			}
 		}
 		return nil
@@ -119,6 +173,8 @@ func (site *site) build() error {
 	if err != nil {
 		return err
 	}
+	// Write asset bundles.
+	site.buildAssetBundles()
 	// Create indexes.
 	site.idxs, err = newIndexes(site)
 	if err != nil {
@@ -127,14 +183,70 @@ func (site *site) build() error {
 	for _, doc := range site.docs.byContentPath {
 		site.idxs.addDocument(doc)
 	}
-	// Build index pages.
-	err = site.idxs.build()
-	if err != nil {
-		return err
+	// Queue index and document rendering tasks. Indexes are prepared
+	// beforehand because index pages and documents include document prev/next
+	// and tag URLs from primary indexes.
+	tasks := []func() error{}
+	for _, idx := range site.idxs {
+		idx.prepare()
+	}
+	site.docs.setSeries()
+	indexHashes := map[*index]string{} // Rendered incremental build indexes.
+	for _, idx := range site.idxs {
+		idx := idx
+		if site.incremental {
+			key := relPath(idx.indexDir, site.buildDir)
+			hash := site.indexHash(idx)
+			if site.cached(prevCache.Indexes, site.cache.Indexes, key, hash) {
+				site.logVerbose2("skip unchanged index: \"%s\"", idx.indexDir)
+				continue
+			}
+			indexHashes[idx] = hash
+		}
+		tasks = append(tasks, func() error {
+			return idx.render(nil)
+		})
 	}
-	// Render documents.
 	for _, doc := range site.docs.byContentPath {
-		if err = site.renderDocument(doc); err != nil {
+		doc := doc
+		if site.incremental {
+			key := relPath(doc.contentPath, site.contentDir)
+			hash := site.documentHash(doc)
+			if site.cached(prevCache.Documents, site.cache.Documents, key, hash) {
+				site.logVerbose2("skip unchanged: \"%s\"", doc.contentPath)
+				if len(site.confs[0].search) > 0 && doc.search {
+					// Render the search text of the unchanged document.
+					if _, err := site.renderBody(doc, doc.frontMatter()); err != nil {
+						return err
+					}
+				}
+				if site.lint {
+					html, err := site.buildFS.ReadFile(doc.buildPath)
+					if err != nil {
+						return err
+					}
+					doc.parseHTML(string(html))
+				}
+				continue
+			}
+			site.record(site.cache.Documents, key, hash, append(append([]string{doc.buildPath}, doc.aliasPaths...), doc.resourcePaths()...)...)
+		}
+		tasks = append(tasks, func() error {
+			return site.renderDocument(doc)
+		})
+	}
+	// Render indexes and documents.
+	if err := site.runTasks(tasks); err != nil {
+		return err
+	}
+	for idx, hash := range indexHashes {
+		site.record(site.cache.Indexes, relPath(idx.indexDir, site.buildDir), hash, idx.outputs...)
+	}
+	if site.incremental {
+		if err := site.removeStaleOutputs(prevCache); err != nil {
+			return err
+		}
+		if err := site.saveCache(); err != nil {
 			return err
 		}
 	}
@@ -142,6 +254,30 @@ func (site *site) build() error {
 	if err := site.copyHomePage(); err != nil {
 		return err
 	}
+	// Write sitemap.
+	if site.confs[0].sitemap {
+		if err := site.buildSitemap(); err != nil {
+			return err
+		}
+	}
+	// Write search indexes.
+	if err := site.buildSearchIndexes(); err != nil {
+		return err
+	}
+	// Write alias redirects file.
+	if err := site.buildRedirects(); err != nil {
+		return err
+	}
+	// Write fingerprint manifest.
+	if err := site.buildFingerprintManifest(); err != nil {
+		return err
+	}
+	// Write syntax highlighting style sheet.
+	if site.confs[0].highlight != "" {
+		if err := site.buildHighlightCSS(); err != nil {
+			return err
+		}
+	}
 	// Lint documents.
 	if site.lint {
 		site.lintChecks()
@@ -160,6 +296,51 @@ func (site *site) build() error {
 	return nil
 }
 
+// runTasks executes tasks concurrently using a pool of `site.jobs` workers.
+// Once a task fails (or the site context is canceled) no further tasks are
+// started and the first error is returned.
+func (site *site) runTasks(tasks []func() error) error {
+	jobs := site.jobs
+	if jobs < 1 {
+		jobs = 1
+	}
+	queue := make(chan func() error)
+	errs := make(chan error, len(tasks))
+	var wg sync.WaitGroup
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for task := range queue {
+				if err := task(); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+	var err error
+	for _, task := range tasks {
+		select {
+		case err = <-errs:
+		default:
+		}
+		if err == nil && site.ctx != nil {
+			err = site.ctx.Err()
+		}
+		if err != nil {
+			break
+		}
+		queue <- task
+	}
+	close(queue)
+	wg.Wait()
+	close(errs)
+	if err == nil {
+		err = <-errs
+	}
+	return err
+}
+
 // copyHomePage copies the `homepage` config variable file to `/index.html` and
 // adds it to the list of built documents.
 func (site *site) copyHomePage() error {
@@ -174,16 +355,20 @@ func (site *site) copyHomePage() error {
 		if !fsx.PathIsInDir(homepage, site.buildDir) {
 			return fmt.Errorf("homepage must reside in build directory: \"%s\"", site.buildDir)
 		}
-		if fsx.DirExists(homepage) {
+		if site.buildFS.DirExists(homepage) {
 			return fmt.Errorf("homepage cannot be a directory: \"%s\"", homepage)
 		}
-		if !fsx.FileExists(homepage) {
+		if !site.buildFS.FileExists(homepage) {
 			return fmt.Errorf("homepage file missing: \"%s\"", homepage)
 		}
 		dst := filepath.Join(site.buildDir, "index.html")
 		site.logVerbose2("copy homepage: \"%s\"", homepage)
 		site.logVerbose("write homepage: \"%s\"", dst)
-		if err := fsx.CopyFile(homepage, dst); err != nil {
+		html, err := site.buildFS.ReadFile(homepage)
+		if err != nil {
+			return err
+		}
+		if err := site.buildFS.WriteFile(dst, html); err != nil {
 			return err
 		}
 		site.docs.byBuildPath[dst] = site.docs.byBuildPath[homepage]
@@ -192,27 +377,37 @@ func (site *site) copyHomePage() error {
 }
 
 func (site *site) buildStaticFile(f string) error {
+	if index := site.bundleIndex(f); index != "" {
+		if doc := site.docs.byContentPath[index]; doc != nil {
+			return site.copyResource(doc, f)
+		}
+		return nil
+	}
 	conf := site.configFor(f)
 	if site.match(f, conf.templates) {
 		return site.renderStaticFile(f)
 	}
-	return site.copyStaticFile(f)
+	if err := site.copyStaticFile(f); err != nil {
+		return err
+	}
+	return site.buildImageDerivatives(f)
 }
 
 // copyStaticFile copies the content directory srcFile to corresponding build
-// directory. Creates missing destination directories.
+// directory.
 func (site *site) copyStaticFile(srcFile string) error {
 	if !fsx.PathIsInDir(srcFile, site.contentDir) {
 		panic("static file is outside content directory: " + srcFile)
 	}
 	dstFile := fsx.PathTranslate(srcFile, site.contentDir, site.buildDir)
 	site.logVerbose("copy static: \"%s\"", srcFile)
-	err := fsx.MkMissingDir(filepath.Dir(dstFile))
+	contents, err := site.vfs(srcFile).ReadFile(srcFile)
 	if err != nil {
 		return err
 	}
-	err = fsx.CopyFile(srcFile, dstFile)
-	if err != nil {
+	contents = site.minify(dstFile, contents)
+	dstFile = site.fingerprintPath(srcFile, dstFile, contents)
+	if err = site.buildFS.WriteFile(dstFile, []byte(contents)); err != nil {
 		return err
 	}
 	site.logVerbose2("write static: \"%s\"", dstFile)
@@ -220,8 +415,7 @@ func (site *site) copyStaticFile(srcFile string) error {
 }
 
 // renderStaticFile renders file f from the content directory as a text template
-// and writes it to the corresponding build directory. Creates missing
-// destination directories.
+// and writes it to the corresponding build directory.
 func (site *site) renderStaticFile(f string) error {
 	// Parse document.
 	doc, err := newDocument(f, site)
@@ -234,46 +428,80 @@ func (site *site) renderStaticFile(f string) error {
 	content := doc.content
 	if site.match(doc.contentPath, doc.templates) {
 		data := doc.frontMatter()
-		content, err = site.textTemplates.render("staticFile", content, data)
+		content, err = site.textTemplates.render("staticFile", content, data, doc.funcs())
 		if err != nil {
 			return err
 		}
 	}
-	site.logVerbose("write static: \"%s\"", doc.buildPath)
-	return fsx.WritePath(doc.buildPath, content)
+	content = site.minify(doc.buildPath, content)
+	dst := site.fingerprintPath(f, doc.buildPath, content)
+	site.logVerbose("write static: \"%s\"", dst)
+	return site.buildFS.WriteFile(dst, []byte(content))
 }
 
 func (site *site) renderDocument(doc *document) error {
-	var err error
 	data := doc.frontMatter()
-	markup := doc.content
-	// Render document markup as a text template.
-	if site.match(doc.contentPath, doc.templates) {
-		site.logVerbose2("render template: \"%s\"", doc.contentPath)
-		markup, err = site.textTemplates.render("documentMarkup", markup, data)
-		if err != nil {
-			return err
-		}
+	body, err := site.renderBody(doc, data)
+	if err != nil {
+		return err
 	}
-	// Convert markup to HTML then render document layout to build directory.
-	site.logVerbose2("render document: \"%s\"", doc.contentPath)
-	data["body"] = doc.render(markup)
-	html, err := site.htmlTemplates.render(doc.layout, data)
+	// Render document layout to build directory.
+	body, toc := doc.buildTOC(body)
+	data["body"] = template.HTML(body)
+	data["toc"] = toc
+	data["tochtml"] = tocHTML(toc)
+	data["related"] = doc.related.frontMatter()["docs"]
+	if doc.series != "" {
+		data["series"] = doc.seriesData()
+	}
+	html, err := site.htmlTemplates.render(doc.layout, data, doc.funcs())
 	if err != nil {
 		return err
 	}
+	html = site.injectSrcset(html)
+	html = site.injectFingerprints(html)
 	html = site.injectUrlprefix(html)
 	if site.lint {
 		doc.parseHTML(html)
 	}
+	html = site.minify(doc.buildPath, html)
 	site.logVerbose("write document: \"%s\"", doc.buildPath)
-	if err = fsx.WritePath(doc.buildPath, html); err != nil {
+	if err = site.buildFS.WriteFile(doc.buildPath, []byte(html)); err != nil {
+		return err
+	}
+	if err = site.renderAliases(doc); err != nil {
+		return err
+	}
+	if err = site.copyResources(doc); err != nil {
 		return err
 	}
 	site.logVerbose2(doc.String())
 	return nil
 }
 
+// renderBody renders the document markup to HTML and assigns the document
+// search text. Markup is rendered as a text template with document front matter
+// data if it matches the `templates` configuration variable.
+func (site *site) renderBody(doc *document, data templateData) (string, error) {
+	var err error
+	markup := doc.content
+	// Render document markup as a text template.
+	if site.match(doc.contentPath, doc.templates) {
+		site.logVerbose2("render template: \"%s\"", doc.contentPath)
+		markup, err = site.textTemplates.render("documentMarkup", markup, data, doc.funcs())
+		if err != nil {
+			return "", err
+		}
+	}
+	// Convert markup to HTML.
+	site.logVerbose2("render document: \"%s\"", doc.contentPath)
+	body := string(doc.render(markup))
+	if len(site.confs[0].search) > 0 && doc.search {
+		doc.text = plainText(body)
+	}
+	return body, nil
+}
+
 // injectUrlprefix prefixes root-relative URLs in HTML
 // href and and src attributes with the site `urlprefix`.
 func (site *site) injectUrlprefix(html string) string {
@@ -284,3 +512,18 @@ func (site *site) injectUrlprefix(html string) string {
 	}
 	return html
 }
+
+// minify returns the minified contents of build file f if the root
+// configuration `minify` variable is set. Files that cannot be minified are
+// logged as warnings and their contents returned unchanged.
+func (site *site) minify(f, contents string) string {
+	if !site.confs[0].minify || !minify.Supported(filepath.Ext(f)) {
+		return contents
+	}
+	result, err := minify.Minify(filepath.Ext(f), contents)
+	if err != nil {
+		site.logWarning("minify: \"%s\": %s", f, err.Error())
+		return contents
+	}
+	return result
+}
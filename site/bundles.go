@@ -0,0 +1,118 @@
+package site
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/srackham/hindsite/v2/fsx"
+)
+
+/*
+A page bundle is a content directory (other than the content directory root)
+containing an `index.md` or `index.rmu` document. The bundle's sibling static
+files are the document's resources, they are copied to the document's build
+directory.
+*/
+
+// isBundleIndex returns true if content file f is a page bundle index document.
+func (site *site) isBundleIndex(f string) bool {
+	return site.isDocument(f) && fsx.FileName(f) == "index" && filepath.Dir(f) != site.contentDir
+}
+
+// bundleIndex returns the content path of the page bundle index document that
+// static file f belongs to (blank if f does not belong to a page bundle).
+func (site *site) bundleIndex(f string) string {
+	if site.isDocument(f) {
+		return ""
+	}
+	dir := filepath.Dir(f)
+	if dir == site.contentDir {
+		return ""
+	}
+	for _, ext := range []string{".md", ".rmu"} {
+		index := filepath.Join(dir, "index"+ext)
+		if site.vfs(index).FileExists(index) && !site.exclude(index) {
+			return index
+		}
+	}
+	return ""
+}
+
+// setResources assigns the page bundle's static files to the document
+// resources.
+func (doc *document) setResources() error {
+	site := doc.site
+	dir := filepath.Dir(doc.contentPath)
+	doc.resources = nil
+	return site.vfs(dir).Walk(dir, func(f string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if f != dir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if site.bundleIndex(f) != doc.contentPath || site.exclude(f) {
+			return nil
+		}
+		if doc.resourcePath(f) == doc.buildPath {
+			site.logWarning("\"%s\": resource conflicts with document build path: \"%s\"", f, doc.buildPath)
+			return nil
+		}
+		doc.resources = append(doc.resources, f)
+		return nil
+	})
+}
+
+// resourcePath returns the build path of document resource f.
+func (doc *document) resourcePath(f string) string {
+	return filepath.Join(filepath.Dir(doc.buildPath), filepath.Base(f))
+}
+
+// resourcePaths returns the build paths of the document resources.
+func (doc *document) resourcePaths() (result []string) {
+	for _, f := range doc.resources {
+		result = append(result, doc.resourcePath(f))
+	}
+	return
+}
+
+// resourcesData returns the document resources template data.
+func (doc *document) resourcesData() []map[string]string {
+	result := []map[string]string{}
+	for _, f := range doc.resources {
+		result = append(result, map[string]string{
+			"name": filepath.Base(f),
+			"url":  rootRelURL(relPath(doc.resourcePath(f), doc.site.buildDir)),
+		})
+	}
+	return result
+}
+
+// copyResource copies document resource f to the document build directory.
+func (site *site) copyResource(doc *document, f string) error {
+	dst := doc.resourcePath(f)
+	site.logVerbose("copy resource: \"%s\"", f)
+	contents, err := site.vfs(f).ReadFile(f)
+	if err != nil {
+		return err
+	}
+	contents = site.minify(dst, contents)
+	if err = site.buildFS.WriteFile(dst, []byte(contents)); err != nil {
+		return err
+	}
+	site.logVerbose2("write resource: \"%s\"", dst)
+	return nil
+}
+
+// copyResources copies the document resources to the document build directory.
+func (site *site) copyResources(doc *document) error {
+	for _, f := range doc.resources {
+		if err := site.copyResource(doc, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,260 @@
+package site
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/srackham/hindsite/v2/fsx"
+	"github.com/srackham/hindsite/v2/imagex"
+	"github.com/srackham/hindsite/v2/set"
+)
+
+// cacheFile is the name of the incremental build cache manifest file. It
+// resides in the root of the build directory.
+const cacheFile = ".hindsite-cache.json"
+
+// buildCache records the inputs hash and the output files of each document,
+// index and static file processed by a build. The `-incremental` build option
+// uses the previous build's cache to skip processing unchanged files.
+type buildCache struct {
+	Version   string                `json:"version"`   // Hindsite version that wrote the cache.
+	Hash      string                `json:"hash"`      // Site-wide configuration and templates hash.
+	Documents map[string]cacheEntry `json:"documents"` // Keyed by content file path.
+	Indexes   map[string]cacheEntry `json:"indexes"`   // Keyed by index build directory.
+	Static    map[string]cacheEntry `json:"static"`    // Keyed by content file path.
+}
+
+// cacheEntry records build inputs and outputs. Paths are slash-separated and
+// relative to the content and build directories.
+type cacheEntry struct {
+	Hash    string   `json:"hash"`    // Inputs hash.
+	Outputs []string `json:"outputs"` // Build files.
+}
+
+func newBuildCache() buildCache {
+	return buildCache{
+		Version:   VERS,
+		Documents: map[string]cacheEntry{},
+		Indexes:   map[string]cacheEntry{},
+		Static:    map[string]cacheEntry{},
+	}
+}
+
+// hashOf returns the hex-encoded SHA-256 hash of the concatenated values.
+func hashOf(values ...string) string {
+	h := sha256.New()
+	for _, v := range values {
+		h.Write([]byte(v))
+		h.Write([]byte{0})
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// relPath returns slash-separated path p relative to directory dir.
+func relPath(p, dir string) string {
+	rel, err := filepath.Rel(dir, p)
+	if err != nil {
+		panic(err)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// loadCache reads the previous build cache from the build directory. An empty
+// cache is returned if the cache file is missing, unreadable or was written by
+// a different version of hindsite.
+func (site *site) loadCache() buildCache {
+	cache := newBuildCache()
+	f := filepath.Join(site.buildDir, cacheFile)
+	if !site.buildFS.FileExists(f) {
+		return cache
+	}
+	text, err := site.buildFS.ReadFile(f)
+	if err == nil {
+		prev := newBuildCache()
+		err = json.Unmarshal(text, &prev)
+		if err == nil && prev.Version == VERS {
+			cache = prev
+		}
+	}
+	if err != nil {
+		site.logWarning("ignored corrupt build cache: \"%s\": %s", f, err.Error())
+	}
+	return cache
+}
+
+// saveCache writes the build cache to the build directory.
+func (site *site) saveCache() error {
+	data, err := json.MarshalIndent(site.cache, "", "  ")
+	if err != nil {
+		return err
+	}
+	f := filepath.Join(site.buildDir, cacheFile)
+	site.logVerbose2("write cache: \"%s\"", f)
+	return site.buildFS.WriteFile(f, data)
+}
+
+// siteHash returns a hash of the site-wide build inputs: the root
+// configuration, all template directory files and the Rimu `config.rmu` file.
+// A change to any of these invalidates the entire build cache.
+func (site *site) siteHash() (string, error) {
+	values := []string{VERS, site.confs[0].String()}
+	files := []string{}
+	err := site.vfs(site.templateDir).Walk(site.templateDir, func(f string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && f == site.initDir {
+			return filepath.SkipDir
+		}
+		if !info.IsDir() {
+			files = append(files, f)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if f := filepath.Join(site.contentDir, "config.rmu"); site.vfs(f).FileExists(f) {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+	for _, f := range files {
+		text, err := site.vfs(f).ReadFile(f)
+		if err != nil {
+			return "", err
+		}
+		values = append(values, f, text)
+	}
+	return hashOf(values...), nil
+}
+
+// documentHash returns a hash of all the inputs that contribute to the
+// document's rendered webpage.
+func (site *site) documentHash(doc *document) string {
+	values := []string{site.cache.Hash, site.fingerprintsHash(), doc.hash, doc.modtime.String(), doc.buildPath}
+	if doc.prev != nil {
+		values = append(values, doc.prev.url)
+	}
+	if doc.next != nil {
+		values = append(values, doc.next.url)
+	}
+	// Related documents are hashed by front matter (not content) so that
+	// content edits do not trigger the rebuild of related documents.
+	for _, d := range doc.related {
+		values = append(values, d.url, d.title, nz(d.author), d.description, d.date.String(), strings.Join(d.tags, "|"))
+	}
+	for _, d := range doc.seriesDocs {
+		values = append(values, d.url, d.title)
+	}
+	for _, f := range doc.resources {
+		if info, err := site.vfs(f).Stat(f); err == nil {
+			values = append(values, f, fmt.Sprint(info.Size()), info.ModTime().String())
+		}
+	}
+	if doc.primaryIndex != nil {
+		for _, t := range doc.conf.allTaxonomies() {
+			for _, term := range doc.taxonomyTerms(t) {
+				values = append(values, t.name, term, doc.primaryIndex.termSlug(t.name, term))
+			}
+		}
+	}
+	return hashOf(values...)
+}
+
+// indexHash returns a hash of the index documents. The documents of the
+// enclosing primary index are hashed because they determine tag URL slugs.
+func (site *site) indexHash(idx *index) string {
+	primary := idx
+	for _, idx2 := range site.idxs {
+		if idx2.isPrimary && fsx.PathIsInDir(idx.templateDir, idx2.templateDir) {
+			primary = idx2
+		}
+	}
+	docs := append(documentsList{}, primary.docs...)
+	sort.Slice(docs, func(i, j int) bool {
+		return docs[i].contentPath < docs[j].contentPath
+	})
+	values := []string{site.cache.Hash, site.fingerprintsHash(), idx.indexDir}
+	for _, doc := range docs {
+		values = append(values, doc.contentPath, doc.hash, doc.modtime.String(), doc.url)
+	}
+	return hashOf(values...)
+}
+
+// staticHash returns a hash of the static file's inputs. Static files are
+// identified by their size and modification time; minified, fingerprinted and
+// text template expanded static files also depend on the site-wide inputs and
+// images on their derivatives configuration.
+func (site *site) staticHash(f string, info os.FileInfo) string {
+	conf := site.configFor(f)
+	values := []string{fmt.Sprint(info.Size()), info.ModTime().String()}
+	if site.match(f, conf.templates) || site.confs[0].minify || site.isFingerprinted(f) {
+		values = append(values, site.cache.Hash)
+	}
+	if imagex.Supported(f) {
+		// Image derivatives depend on the image configuration.
+		values = append(values, fmt.Sprint(conf.imagewidths, conf.thumbnail, conf.jpegquality))
+	}
+	return hashOf(values...)
+}
+
+// cached returns true if the entry from the previous build has the same hash
+// and all its output files exist. Cached entries are carried over to the
+// current build cache.
+func (site *site) cached(prev, cur map[string]cacheEntry, key, hash string) bool {
+	entry, ok := prev[key]
+	if !ok || entry.Hash != hash {
+		return false
+	}
+	for _, f := range entry.Outputs {
+		if !site.buildFS.FileExists(filepath.Join(site.buildDir, filepath.FromSlash(f))) {
+			return false
+		}
+	}
+	cur[key] = entry
+	return true
+}
+
+// record adds an entry to the current build cache.
+func (site *site) record(cur map[string]cacheEntry, key, hash string, outputs ...string) {
+	entry := cacheEntry{Hash: hash}
+	for _, f := range outputs {
+		entry.Outputs = append(entry.Outputs, relPath(f, site.buildDir))
+	}
+	cur[key] = entry
+}
+
+// removeStaleOutputs deletes build files recorded in the previous build cache
+// that were not output by the current build.
+func (site *site) removeStaleOutputs(prev buildCache) error {
+	outputs := func(cache buildCache) set.Set[string] {
+		result := set.New[string]()
+		for _, entries := range []map[string]cacheEntry{cache.Documents, cache.Indexes, cache.Static} {
+			for _, entry := range entries {
+				result.Add(entry.Outputs...)
+			}
+		}
+		return result
+	}
+	current := outputs(site.cache)
+	stale := outputs(prev).Values()
+	sort.Strings(stale)
+	for _, f := range stale {
+		if current.Has(f) {
+			continue
+		}
+		f = filepath.Join(site.buildDir, filepath.FromSlash(f))
+		if site.buildFS.FileExists(f) {
+			site.logVerbose("delete stale: \"%s\"", f)
+			if err := site.buildFS.Remove(f); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
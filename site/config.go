@@ -3,6 +3,7 @@ package site
 import (
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
 	"strconv"
@@ -10,47 +11,112 @@ import (
 	"time"
 
 	"github.com/BurntSushi/toml"
+	"github.com/srackham/hindsite/v2/highlight"
+	"github.com/srackham/hindsite/v2/slice"
 	yaml "gopkg.in/yaml.v3"
 )
 
 type config struct {
 	origin string // Configuration file directory.
 	// Configuration variables.
-	author    *string           // Default document author (nil if undefined).
-	templates []string          // List of included content templates.
-	homepage  string            // Use this built file for /index.html.
-	paginate  int               // Number of documents per index page. No pagination if zero or less.
-	urlprefix string            // Prefix for synthesized document and index page URLs.
-	permalink string            // URL template.
-	id        string            // Front matter id behavior: "optional",  "mandatory" or "urlpath".
-	exclude   []string          // List of excluded content patterns.
-	include   []string          // List of included content patterns.
-	timezone  *time.Location    // Time zone for site generation.
-	user      map[string]string // User defined configuration key/values.
+	author      *string                // Default document author (nil if undefined).
+	templates   []string               // List of included content templates.
+	homepage    string                 // Use this built file for /index.html.
+	notfound    string                 // Built file served for missing files by the serve command.
+	sitemap     bool                   // Generate sitemap.xml and robots.txt.
+	minify      bool                   // Minify built HTML, CSS, JavaScript, SVG and JSON files.
+	fingerprint []string               // List of fingerprinted static file patterns.
+	bundles     []assetBundle          // CSS and JavaScript asset bundles.
+	search      []string               // List of search indexes: "site", "indexes".
+	redirects   string                 // Document aliases redirects file format: "netlify", "nginx" (no file if blank).
+	highlight   string                 // Syntax highlighting theme (no highlighting if blank).
+	paginate    int                    // Number of documents per index page. No pagination if zero or less.
+	feeds       []string               // List of index feed formats: "atom", "rss".
+	feedsize    int                    // Number of documents per feed. All documents if zero or less.
+	related     int                    // Number of related documents. None if zero or less.
+	sort        string                 // Index document order: "date-desc", "date-asc", "title", "weight" or "filename".
+	taxonomies  []taxonomy             // Document taxonomies in addition to the built-in tags taxonomy.
+	urlprefix   string                 // Prefix for synthesized document and index page URLs.
+	toclevels   [2]int                 // Minimum and maximum table of contents heading levels.
+	anchors     *bool                  // Add self-link anchors to table of contents headings (nil if undefined).
+	imagewidths []int                  // Widths of resized image derivatives.
+	thumbnail   [2]int                 // Width and height of image thumbnails (no thumbnails if zero).
+	jpegquality int                    // JPEG image derivative quality (1 to 100).
+	permalink   string                 // URL template.
+	id          string                 // Front matter id behavior: "optional",  "mandatory" or "urlpath".
+	exclude     []string               // List of excluded content patterns.
+	include     []string               // List of included content patterns.
+	timezone    *time.Location         // Time zone for site generation.
+	user        map[string]interface{} // User defined configuration values.
 	// Date formats for template variables: date, shortdate, mediumdate, longdate.
 	shortdate  string
 	mediumdate string
 	longdate   string
 }
 
+// taxonomy is a named document classification e.g. tags, categories.
+type taxonomy struct {
+	name  string // Taxonomy index name.
+	field string // Front matter field that assigns document terms.
+}
+
+// assetBundle is a CSS or JavaScript build file concatenated from content
+// directory source files.
+type assetBundle struct {
+	name    string   // Slash-separated build file path relative to the build directory.
+	sources []string // Slash-separated source file paths relative to the content directory.
+}
+
+// tagsTaxonomy is the built-in document tags taxonomy.
+var tagsTaxonomy = taxonomy{name: "tags", field: "tags"}
+
+// reservedTaxonomies are taxonomy names that would clash with index page names
+// or with the document template variables set by frontMatter and
+// renderDocument (taxonomy terms share the document template data).
+var reservedTaxonomies = []string{
+	tagsTaxonomy.name, "docs", "archive", "series",
+	"title", "author", "id", "templates", "permalink", "shortdate", "mediumdate",
+	"longdate", "date", "modtime", "layout", "urlprefix", "timezone", "slug",
+	"weight", "url", "resources", "prev", "next", "user", "data", "description",
+	"body", "toc", "tochtml", "related",
+}
+
 // Unvalidated configuration variable values.
 // Undefined configuration variables have a nil pointer value.
 type rawConfig struct {
 	// Configuration variables
-	Author     *string
-	Exclude    *string
-	Homepage   *string
-	ID         *string
-	Include    *string
-	LongDate   *string
-	MediumDate *string
-	Paginate   *int
-	Permalink  *string
-	ShortDate  *string
-	Templates  *string
-	Timezone   *string
-	URLPrefix  *string
-	User       map[string]string
+	Anchors     *bool
+	Author      *string
+	Bundles     *string
+	Exclude     *string
+	Feeds       *string
+	FeedSize    *int
+	Fingerprint *string
+	Highlight   *string
+	Homepage    *string
+	ID          *string
+	ImageWidths *string
+	Include     *string
+	JPEGQuality *int
+	LongDate    *string
+	MediumDate  *string
+	Minify      *bool
+	NotFound    *string
+	Paginate    *int
+	Permalink   *string
+	Redirects   *string
+	Related     *int
+	Search      *string
+	ShortDate   *string
+	Sitemap     *bool
+	Sort        *string
+	Taxonomies  *string
+	Templates   *string
+	Thumbnail   *string
+	Timezone    *string
+	TOCLevels   *string
+	URLPrefix   *string
+	User        map[string]interface{}
 }
 
 // parseVar parses the `NAME=VALUE` var argument `arg` into `vars`.
@@ -62,27 +128,79 @@ func (raw *rawConfig) parseVar(arg string) error {
 	name := s[0]
 	val := s[1]
 	if strings.HasPrefix(name, "user.") {
-		name = strings.TrimPrefix(name, "user.")
+		// Dotted names are assigned to nested user maps.
+		names := strings.Split(strings.TrimPrefix(name, "user."), ".")
 		if raw.User == nil {
-			raw.User = make(map[string]string)
+			raw.User = make(map[string]interface{})
 		}
-		raw.User[name] = val
+		m := raw.User
+		for _, k := range names[:len(names)-1] {
+			if k == "" {
+				return fmt.Errorf("illegal -var name: \"%s\"", name)
+			}
+			child, ok := m[k].(map[string]interface{})
+			if !ok {
+				child = make(map[string]interface{})
+				m[k] = child
+			}
+			m = child
+		}
+		if names[len(names)-1] == "" {
+			return fmt.Errorf("illegal -var name: \"%s\"", name)
+		}
+		m[names[len(names)-1]] = val
 	} else {
 		switch name {
+		case "anchors":
+			if b, err := strconv.ParseBool(val); err != nil {
+				return fmt.Errorf("illegal anchors value: \"%s\"", val)
+			} else {
+				raw.Anchors = &b
+			}
 		case "author":
 			raw.Author = &val
+		case "bundles":
+			raw.Bundles = &val
 		case "exclude":
 			raw.Exclude = &val
+		case "feeds":
+			raw.Feeds = &val
+		case "feedsize":
+			if n, err := strconv.Atoi(val); err != nil {
+				return fmt.Errorf("illegal feedsize value: \"%s\"", val)
+			} else {
+				raw.FeedSize = &n
+			}
+		case "fingerprint":
+			raw.Fingerprint = &val
+		case "highlight":
+			raw.Highlight = &val
 		case "homepage":
 			raw.Homepage = &val
 		case "id":
 			raw.ID = &val
+		case "imagewidths":
+			raw.ImageWidths = &val
 		case "include":
 			raw.Include = &val
+		case "jpegquality":
+			if n, err := strconv.Atoi(val); err != nil {
+				return fmt.Errorf("illegal jpegquality value: \"%s\"", val)
+			} else {
+				raw.JPEGQuality = &n
+			}
 		case "longdate":
 			raw.LongDate = &val
 		case "mediumdate":
 			raw.MediumDate = &val
+		case "minify":
+			if b, err := strconv.ParseBool(val); err != nil {
+				return fmt.Errorf("illegal minify value: \"%s\"", val)
+			} else {
+				raw.Minify = &b
+			}
+		case "notfound":
+			raw.NotFound = &val
 		case "paginate":
 			if n, err := strconv.Atoi(val); err != nil {
 				return fmt.Errorf("illegal paginate value: \"%s\"", val)
@@ -91,12 +209,36 @@ func (raw *rawConfig) parseVar(arg string) error {
 			}
 		case "permalink":
 			raw.Permalink = &val
+		case "redirects":
+			raw.Redirects = &val
+		case "related":
+			if n, err := strconv.Atoi(val); err != nil {
+				return fmt.Errorf("illegal related value: \"%s\"", val)
+			} else {
+				raw.Related = &n
+			}
+		case "search":
+			raw.Search = &val
 		case "shortdate":
 			raw.ShortDate = &val
+		case "sitemap":
+			if b, err := strconv.ParseBool(val); err != nil {
+				return fmt.Errorf("illegal sitemap value: \"%s\"", val)
+			} else {
+				raw.Sitemap = &b
+			}
+		case "sort":
+			raw.Sort = &val
+		case "taxonomies":
+			raw.Taxonomies = &val
 		case "templates":
 			raw.Templates = &val
+		case "thumbnail":
+			raw.Thumbnail = &val
 		case "timezone":
 			raw.Timezone = &val
+		case "toclevels":
+			raw.TOCLevels = &val
 		case "urlprefix":
 			raw.URLPrefix = &val
 		default:
@@ -106,11 +248,16 @@ func (raw *rawConfig) parseVar(arg string) error {
 	return nil
 }
 
-func (raw *rawConfig) parseConfigFile(f string) (err error) {
-	var text []byte
-	if text, err = os.ReadFile(f); err != nil {
+func (raw *rawConfig) parseConfigFile(f string) error {
+	text, err := os.ReadFile(f)
+	if err != nil {
 		return err
 	}
+	return raw.parseConfig(f, text)
+}
+
+// parseConfig parses the text of configuration file f.
+func (raw *rawConfig) parseConfig(f string, text []byte) (err error) {
 	switch filepath.Ext(f) {
 	case ".toml":
 		_, err = toml.Decode(string(text), &raw)
@@ -137,6 +284,51 @@ func (conf *config) mergeRaw(raw rawConfig) error {
 	if raw.Homepage != nil {
 		conf.homepage = *raw.Homepage
 	}
+	if raw.NotFound != nil {
+		f := filepath.FromSlash(*raw.NotFound)
+		if filepath.IsAbs(f) || strings.HasPrefix(filepath.Clean(f), "..") {
+			return fmt.Errorf("illegal notfound: \"%s\"", *raw.NotFound)
+		}
+		conf.notfound = *raw.NotFound
+	}
+	if raw.Sitemap != nil {
+		conf.sitemap = *raw.Sitemap
+	}
+	if raw.Minify != nil {
+		conf.minify = *raw.Minify
+	}
+	if raw.Fingerprint != nil {
+		conf.fingerprint = splitWildcards(*raw.Fingerprint)
+	}
+	if raw.Search != nil {
+		conf.search = []string{}
+		for _, kind := range strings.Split(*raw.Search, "|") {
+			kind = strings.TrimSpace(kind)
+			switch kind {
+			case "":
+			case "site", "indexes":
+				conf.search = append(conf.search, kind)
+			default:
+				return fmt.Errorf("illegal search value: \"%s\"", kind)
+			}
+		}
+	}
+	if raw.Redirects != nil {
+		switch *raw.Redirects {
+		case "", "netlify", "nginx":
+			conf.redirects = *raw.Redirects
+		default:
+			return fmt.Errorf("illegal redirects: \"%s\"", *raw.Redirects)
+		}
+	}
+	if raw.Highlight != nil {
+		if *raw.Highlight != "" {
+			if _, err := highlight.CSS(*raw.Highlight); err != nil {
+				return err
+			}
+		}
+		conf.highlight = *raw.Highlight
+	}
 	if raw.ID != nil {
 		switch *raw.ID {
 		case "optional", "mandatory", "urlpath":
@@ -148,6 +340,129 @@ func (conf *config) mergeRaw(raw rawConfig) error {
 	if raw.Paginate != nil {
 		conf.paginate = *raw.Paginate
 	}
+	if raw.Feeds != nil {
+		conf.feeds = []string{}
+		for _, format := range strings.Split(*raw.Feeds, "|") {
+			format = strings.TrimSpace(format)
+			switch format {
+			case "":
+			case "atom", "rss":
+				conf.feeds = append(conf.feeds, format)
+			default:
+				return fmt.Errorf("illegal feed format: \"%s\"", format)
+			}
+		}
+	}
+	if raw.FeedSize != nil {
+		conf.feedsize = *raw.FeedSize
+	}
+	if raw.Related != nil {
+		conf.related = *raw.Related
+	}
+	if raw.Sort != nil {
+		switch *raw.Sort {
+		case "date-desc", "date-asc", "title", "weight", "filename":
+			conf.sort = *raw.Sort
+		default:
+			return fmt.Errorf("illegal sort: \"%s\"", *raw.Sort)
+		}
+	}
+	if raw.Taxonomies != nil {
+		conf.taxonomies = []taxonomy{}
+		re := regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+		names := slice.New(reservedTaxonomies...) // Reserved and declared taxonomy names.
+		for _, item := range strings.Split(*raw.Taxonomies, "|") {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+			name, field, found := strings.Cut(item, ":")
+			name = strings.TrimSpace(name)
+			field = strings.TrimSpace(field)
+			if !found {
+				field = name
+			}
+			if !re.MatchString(name) || !re.MatchString(field) || names.Has(name) {
+				return fmt.Errorf("illegal taxonomy: \"%s\"", item)
+			}
+			names = append(names, name)
+			conf.taxonomies = append(conf.taxonomies, taxonomy{name: name, field: field})
+		}
+	}
+	if raw.Bundles != nil {
+		conf.bundles = []assetBundle{}
+		names := slice.New[string]()
+		// isLocal returns true if slash-separated path p is a relative path
+		// that does not escape its parent directory.
+		isLocal := func(p string) bool {
+			return p != "" && !path.IsAbs(p) && !filepath.IsAbs(filepath.FromSlash(p)) && !strings.HasPrefix(path.Clean(p), "..")
+		}
+		for _, item := range strings.Split(*raw.Bundles, "|") {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+			name, sources, found := strings.Cut(item, ":")
+			name = filepath.ToSlash(strings.TrimSpace(name))
+			ext := path.Ext(name)
+			if !found || !isLocal(name) || (ext != ".css" && ext != ".js") || names.Has(path.Clean(name)) {
+				return fmt.Errorf("illegal bundle: \"%s\"", item)
+			}
+			bundle := assetBundle{name: path.Clean(name)}
+			for _, src := range strings.Split(sources, ",") {
+				src = filepath.ToSlash(strings.TrimSpace(src))
+				if src == "" {
+					continue
+				}
+				if !isLocal(src) || path.Ext(src) != ext {
+					return fmt.Errorf("illegal bundle source: \"%s\"", src)
+				}
+				bundle.sources = append(bundle.sources, path.Clean(src))
+			}
+			if len(bundle.sources) == 0 {
+				return fmt.Errorf("illegal bundle: \"%s\"", item)
+			}
+			names = append(names, bundle.name)
+			conf.bundles = append(conf.bundles, bundle)
+		}
+	}
+	if raw.ImageWidths != nil {
+		conf.imagewidths = []int{}
+		for _, w := range strings.Split(*raw.ImageWidths, "|") {
+			w = strings.TrimSpace(w)
+			if w == "" {
+				continue
+			}
+			n, err := strconv.Atoi(w)
+			if err != nil || n < 1 {
+				return fmt.Errorf("illegal imagewidths: \"%s\"", *raw.ImageWidths)
+			}
+			conf.imagewidths = append(conf.imagewidths, n)
+		}
+	}
+	if raw.Thumbnail != nil {
+		var width, height int
+		if n, err := fmt.Sscanf(*raw.Thumbnail, "%dx%d", &width, &height); err != nil || n != 2 || width < 1 || height < 1 {
+			return fmt.Errorf("illegal thumbnail: \"%s\"", *raw.Thumbnail)
+		}
+		conf.thumbnail = [2]int{width, height}
+	}
+	if raw.JPEGQuality != nil {
+		if *raw.JPEGQuality < 1 || *raw.JPEGQuality > 100 {
+			return fmt.Errorf("illegal jpegquality: \"%d\"", *raw.JPEGQuality)
+		}
+		conf.jpegquality = *raw.JPEGQuality
+	}
+	if raw.TOCLevels != nil {
+		var min, max int
+		if n, err := fmt.Sscanf(*raw.TOCLevels, "%d-%d", &min, &max); err != nil || n != 2 || min < 1 || max > 6 || min > max {
+			return fmt.Errorf("illegal toclevels: \"%s\"", *raw.TOCLevels)
+		}
+		conf.toclevels = [2]int{min, max}
+	}
+	if raw.Anchors != nil {
+		conf.anchors = raw.Anchors
+	}
 	if raw.URLPrefix != nil {
 		value := *raw.URLPrefix
 		re := regexp.MustCompile(`^(http[s]?://|/)[\w.~/-]*[^/]$`) // See also RFC 3986.
@@ -178,10 +493,21 @@ func (conf *config) mergeRaw(raw rawConfig) error {
 	if raw.LongDate != nil {
 		conf.longdate = *raw.LongDate
 	}
-	mergeMap(conf.user, raw.User)
+	if raw.User != nil {
+		if conf.user == nil {
+			conf.user = map[string]interface{}{}
+		}
+		deepMergeMap(conf.user, raw.User)
+	}
 	return nil
 }
 
+// allTaxonomies returns the built-in tags taxonomy followed by the configured
+// taxonomies.
+func (conf *config) allTaxonomies() []taxonomy {
+	return append([]taxonomy{tagsTaxonomy}, conf.taxonomies...)
+}
+
 // Return configuration as a map keyed by parameter name.
 func (conf *config) data() templateData {
 	data := templateData{}
@@ -190,8 +516,41 @@ func (conf *config) data() templateData {
 	data["id"] = conf.id
 	data["permalink"] = conf.permalink
 	data["homepage"] = conf.homepage
+	data["notfound"] = conf.notfound
+	data["sitemap"] = conf.sitemap
+	data["minify"] = conf.minify
+	data["fingerprint"] = strings.Join(conf.fingerprint, "|")
+	bundles := []string{}
+	for _, b := range conf.bundles {
+		bundles = append(bundles, b.name+":"+strings.Join(b.sources, ","))
+	}
+	data["bundles"] = strings.Join(bundles, "|")
+	data["search"] = strings.Join(conf.search, "|")
+	data["redirects"] = conf.redirects
+	data["highlight"] = conf.highlight
 	data["paginate"] = conf.paginate
+	data["feeds"] = strings.Join(conf.feeds, "|")
+	data["feedsize"] = conf.feedsize
+	data["related"] = conf.related
+	data["sort"] = conf.sort
+	taxonomies := []string{}
+	for _, t := range conf.taxonomies {
+		taxonomies = append(taxonomies, t.name+":"+t.field)
+	}
+	data["taxonomies"] = strings.Join(taxonomies, "|")
 	data["urlprefix"] = conf.urlprefix
+	data["toclevels"] = fmt.Sprintf("%d-%d", conf.toclevels[0], conf.toclevels[1])
+	data["anchors"] = conf.anchors != nil && *conf.anchors
+	widths := []string{}
+	for _, w := range conf.imagewidths {
+		widths = append(widths, strconv.Itoa(w))
+	}
+	data["imagewidths"] = strings.Join(widths, "|")
+	data["thumbnail"] = ""
+	if conf.thumbnail != [2]int{} {
+		data["thumbnail"] = fmt.Sprintf("%dx%d", conf.thumbnail[0], conf.thumbnail[1])
+	}
+	data["jpegquality"] = conf.jpegquality
 	data["exclude"] = strings.Join(conf.exclude, "|")
 	data["include"] = strings.Join(conf.include, "|")
 	data["timezone"] = conf.timezone.String()
@@ -228,6 +587,21 @@ func (conf *config) merge(src config) {
 	if src.paginate != 0 {
 		conf.paginate = src.paginate
 	}
+	if src.feeds != nil {
+		conf.feeds = src.feeds
+	}
+	if src.feedsize != 0 {
+		conf.feedsize = src.feedsize
+	}
+	if src.related != 0 {
+		conf.related = src.related
+	}
+	if src.sort != "" {
+		conf.sort = src.sort
+	}
+	if src.taxonomies != nil {
+		conf.taxonomies = src.taxonomies
+	}
 	if src.timezone != nil {
 		conf.timezone = src.timezone
 	}
@@ -243,14 +617,53 @@ func (conf *config) merge(src config) {
 	if src.homepage != "" {
 		conf.homepage = src.homepage
 	}
+	if src.notfound != "" {
+		conf.notfound = src.notfound
+	}
+	if src.sitemap {
+		conf.sitemap = src.sitemap
+	}
+	if src.minify {
+		conf.minify = src.minify
+	}
+	if src.fingerprint != nil {
+		conf.fingerprint = src.fingerprint
+	}
+	if src.bundles != nil {
+		conf.bundles = src.bundles
+	}
+	if src.search != nil {
+		conf.search = src.search
+	}
+	if src.redirects != "" {
+		conf.redirects = src.redirects
+	}
+	if src.highlight != "" {
+		conf.highlight = src.highlight
+	}
 	if src.urlprefix != "" {
 		conf.urlprefix = src.urlprefix
 	}
+	if src.toclevels != [2]int{} {
+		conf.toclevels = src.toclevels
+	}
+	if src.imagewidths != nil {
+		conf.imagewidths = src.imagewidths
+	}
+	if src.thumbnail != [2]int{} {
+		conf.thumbnail = src.thumbnail
+	}
+	if src.jpegquality != 0 {
+		conf.jpegquality = src.jpegquality
+	}
+	if src.anchors != nil {
+		conf.anchors = src.anchors
+	}
 	if src.exclude != nil {
 		conf.exclude = src.exclude
 	}
 	if src.include != nil {
 		conf.include = src.include
 	}
-	mergeMap(conf.user, src.user)
+	deepMergeMap(conf.user, src.user)
 }
@@ -0,0 +1,76 @@
+package site
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/srackham/hindsite/v2/fsx"
+	"github.com/srackham/hindsite/v2/set"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// loadData parses YAML, TOML and JSON files from the template `data` directory
+// into `site.data`. Each file's data is keyed by its file name (sans
+// extension); files in subdirectories are nested in maps keyed by the
+// subdirectory name.
+func (site *site) loadData() error {
+	site.data = templateData{}
+	vfs := site.vfs(site.dataDir)
+	if !vfs.DirExists(site.dataDir) {
+		return nil
+	}
+	dirs := set.New[string]() // Nested data map paths.
+	return vfs.Walk(site.dataDir, func(f string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".") {
+			return nil
+		}
+		var value interface{}
+		text, err := vfs.ReadFile(f)
+		if err != nil {
+			return err
+		}
+		switch filepath.Ext(f) {
+		case ".yaml", ".yml":
+			err = yaml.Unmarshal([]byte(text), &value)
+		case ".toml":
+			m := map[string]interface{}{}
+			_, err = toml.Decode(text, &m)
+			value = m
+		case ".json":
+			err = json.Unmarshal([]byte(text), &value)
+		default:
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("data file: \"%s\": %s", f, err.Error())
+		}
+		// Find or create the nested map for the file's directory.
+		rel, _ := filepath.Rel(site.dataDir, f)
+		names := strings.Split(filepath.ToSlash(rel), "/")
+		m := map[string]interface{}(site.data)
+		for i, name := range names[:len(names)-1] {
+			p := strings.Join(names[:i+1], "/")
+			if m[name] == nil {
+				m[name] = map[string]interface{}{}
+				dirs.Add(p)
+			} else if !dirs.Has(p) {
+				return fmt.Errorf("data file: \"%s\": conflicting data name: \"%s\"", f, name)
+			}
+			m = m[name].(map[string]interface{})
+		}
+		name := fsx.FileName(f)
+		if _, ok := m[name]; ok {
+			return fmt.Errorf("data file: \"%s\": conflicting data name: \"%s\"", f, name)
+		}
+		site.logVerbose("read data: \"%s\"", f)
+		m[name] = value
+		return nil
+	})
+}
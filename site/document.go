@@ -4,12 +4,13 @@ import (
 	"bufio"
 	"fmt"
 	"html/template"
-	"os"
 	"path"
 	"path/filepath"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/srackham/hindsite/v2/fsx"
@@ -21,6 +22,9 @@ import (
 	yaml "gopkg.in/yaml.v3"
 )
 
+// rimuMutex serializes Rimu rendering because the Rimu renderer has global state.
+var rimuMutex sync.Mutex
+
 type document struct {
 	site         *site  // Context.
 	conf         config // Merged configuration for this document.
@@ -29,25 +33,39 @@ type document struct {
 	templatePath string              // Virtual path used to find document related templates.
 	content      string              // Markup text (without front matter header).
 	modtime      time.Time           // Document source file modified timestamp.
+	hash         string              // Document source file hash.
 	primaryIndex *index              // Top-level document index (nil if document is not indexed).
 	prev         *document           // Previous document in primary index.
 	next         *document           // Next document in primary index.
+	related      documentsList       // Documents in primary index that share tags.
+	seriesDocs   documentsList       // Ordered documents in the document's series.
 	ids          slice.Slice[string] // HTML element ids.
 	urls         slice.Slice[string] // HTML element href and src attributes.
+	text         string              // Rendered document body plain text (for search indexes).
+	aliasPaths   []string            // Build paths of the alias redirect pages.
+	resources    []string            // Page bundle static files.
 	// Front matter.
 	title       string
 	date        time.Time
+	expires     time.Time // Document is excluded from builds after this date (unless zero).
 	author      *string
 	id          *string // Unique document ID.
 	templates   []string
 	description string
-	url         string // Raw document root-relative URL.
+	url         string   // Raw document root-relative URL.
+	aliases     []string // Root-relative URLs that redirect to the document.
 	tags        []string
+	terms       map[string][]string // Taxonomy terms keyed by front matter field (excluding tags).
 	draft       bool
+	sitemap     bool   // Include document in sitemap.
+	search      bool   // Include document in search indexes.
+	weight      int    // Index order when the `sort` configuration variable is "weight".
+	series      string // Series title.
+	seriesPart  int    // Series order.
 	permalink   string // URL template.
 	slug        string
-	layout      string            // Document template name.
-	user        map[string]string // User defined configuration key/values.
+	layout      string                 // Document template name.
+	user        map[string]interface{} // User defined configuration values.
 }
 
 // Parse document content and front matter.
@@ -58,13 +76,14 @@ func newDocument(contentfile string, site *site) (document, error) {
 	if !fsx.PathIsInDir(contentfile, site.contentDir) {
 		panic("document is outside content directory: " + contentfile)
 	}
-	if !fsx.FileExists(contentfile) {
+	vfs := site.vfs(contentfile)
+	if !vfs.FileExists(contentfile) {
 		panic("missing document: " + contentfile)
 	}
 	doc := document{}
 	doc.contentPath = contentfile
 	doc.site = site
-	info, err := os.Stat(contentfile)
+	info, err := vfs.Stat(contentfile)
 	if err != nil {
 		return doc, parseError(err)
 	}
@@ -82,10 +101,13 @@ func newDocument(contentfile string, site *site) (document, error) {
 	doc.author = doc.conf.author       // Default author.
 	doc.templates = doc.conf.templates // Default templates.
 	doc.permalink = doc.conf.permalink // Default permalink.
-	doc.content, err = fsx.ReadFile(doc.contentPath)
+	doc.sitemap = true
+	doc.search = true
+	doc.content, err = vfs.ReadFile(doc.contentPath)
 	if err != nil {
 		return doc, parseError(err)
 	}
+	doc.hash = hashOf(doc.content)
 	if err := doc.extractFrontMatter(); err != nil {
 		return doc, parseError(fmt.Errorf("front matter: %s", err.Error()))
 	}
@@ -101,6 +123,10 @@ func newDocument(contentfile string, site *site) (document, error) {
 		f = doc.slug + filepath.Ext(f)
 	}
 	if doc.permalink != "" {
+		if site.isBundleIndex(doc.contentPath) && doc.slug == "" {
+			// Page bundles are named after the bundle directory.
+			f = filepath.Base(filepath.Dir(rel)) + filepath.Ext(f)
+		}
 		link := doc.permalink
 		link = strings.Replace(link, "%y", doc.date.Format("2006"), -1)
 		link = strings.Replace(link, "%m", doc.date.Format("01"), -1)
@@ -120,6 +146,14 @@ func newDocument(contentfile string, site *site) (document, error) {
 		doc.buildPath = filepath.Join(site.buildDir, filepath.Dir(rel), f)
 		doc.url = rootRelURL(path.Dir(filepath.ToSlash(rel)), f)
 	}
+	if err := doc.setAliasPaths(); err != nil {
+		return doc, parseError(err)
+	}
+	if site.isBundleIndex(doc.contentPath) {
+		if err := doc.setResources(); err != nil {
+			return doc, parseError(err)
+		}
+	}
 	if doc.layout == "" {
 		// Find nearest document layout template file.
 		layout := ""
@@ -215,21 +249,28 @@ func (doc *document) extractFrontMatter() error {
 	fm := struct {
 		Title       string
 		Date        string
+		Expires     string
 		Description string
 		Author      *string
 		Templates   *string
 		Tags        []string
+		Aliases     []string
 		Draft       bool
+		Sitemap     *bool
+		Search      *bool
+		Weight      int
+		Series      string
+		SeriesPart  int `toml:"series_part" yaml:"series_part"`
 		Permalink   string
 		Slug        string
 		Layout      string
 		ID          *string
-		User        map[string]string
+		User        map[string]interface{}
 	}{}
 	switch format {
 	case "toml":
-		re := regexp.MustCompile(`(?m)^[ \t]*date[ \t]*=[ \t]*([^" \t][^#\n\r]*)`)
-		header = re.ReplaceAllString(header, `date="$1"`) // Convert unquoted TOML date/times to quoted string.
+		re := regexp.MustCompile(`(?m)^[ \t]*(date|expires)[ \t]*=[ \t]*([^" \t][^#\n\r]*)`)
+		header = re.ReplaceAllString(header, `$1="$2"`) // Convert unquoted TOML date/times to quoted string.
 		if _, err := toml.Decode(header, &fm); err != nil {
 			return err
 		}
@@ -249,6 +290,13 @@ func (doc *document) extractFrontMatter() error {
 		}
 		doc.date = d
 	}
+	if fm.Expires != "" {
+		d, err := parseDate(fm.Expires, doc.conf.timezone)
+		if err != nil {
+			return err
+		}
+		doc.expires = d
+	}
 	if fm.Author != nil {
 		doc.author = fm.Author
 	}
@@ -267,9 +315,27 @@ func (doc *document) extractFrontMatter() error {
 	if fm.Tags != nil {
 		doc.tags = fm.Tags
 	}
+	if fm.Aliases != nil {
+		doc.aliases = fm.Aliases
+	}
 	if !doc.draft {
 		doc.draft = fm.Draft
 	}
+	if fm.Sitemap != nil {
+		doc.sitemap = *fm.Sitemap
+	}
+	if fm.Search != nil {
+		doc.search = *fm.Search
+	}
+	if fm.Weight != 0 {
+		doc.weight = fm.Weight
+	}
+	if fm.Series != "" {
+		doc.series = fm.Series
+	}
+	if fm.SeriesPart != 0 {
+		doc.seriesPart = fm.SeriesPart
+	}
 	if fm.Slug != "" {
 		doc.slug = fm.Slug
 	}
@@ -279,9 +345,53 @@ func (doc *document) extractFrontMatter() error {
 	if fm.User != nil {
 		doc.user = fm.User
 	}
+	if len(doc.conf.taxonomies) > 0 {
+		// Assign taxonomy terms from front matter fields.
+		fields := map[string]interface{}{}
+		switch format {
+		case "toml":
+			if _, err := toml.Decode(header, &fields); err != nil {
+				return err
+			}
+		case "yaml":
+			if err := yaml.Unmarshal([]byte(header), &fields); err != nil {
+				return err
+			}
+		}
+		for _, t := range doc.conf.taxonomies {
+			for k, v := range fields {
+				if !strings.EqualFold(k, t.field) || t.field == tagsTaxonomy.field {
+					continue
+				}
+				terms := []string{}
+				switch v := v.(type) {
+				case string:
+					terms = append(terms, v)
+				case []interface{}:
+					for _, term := range v {
+						terms = append(terms, fmt.Sprint(term))
+					}
+				default:
+					return fmt.Errorf("illegal %s value: %v", t.field, v)
+				}
+				if doc.terms == nil {
+					doc.terms = map[string][]string{}
+				}
+				doc.terms[t.field] = terms
+			}
+		}
+	}
 	return nil
 }
 
+// taxonomyTerms returns the document's taxonomy terms.
+func (doc *document) taxonomyTerms(t taxonomy) []string {
+	if t.field == tagsTaxonomy.field {
+		return doc.tags
+	}
+	return doc.terms[t.field]
+}
+
 // frontMatter returns document template data including merged configuration variables.
 func (doc *document) frontMatter() templateData {
 	data := templateData{}
@@ -297,13 +407,16 @@ func (doc *document) frontMatter() templateData {
 	data["modtime"] = doc.modtime
 	data["layout"] = doc.layout
 	data["urlprefix"] = doc.conf.urlprefix
+	data["timezone"] = doc.conf.timezone.String()
 	data["slug"] = doc.slug
+	data["weight"] = doc.weight
 	data["url"] = doc.url
+	data["resources"] = doc.resourcesData()
 	tags := []map[string]string{}
 	for _, tag := range doc.tags {
 		url := ""
 		if doc.primaryIndex != nil {
-			url = rootRelURL(doc.primaryIndex.url, "tags", doc.primaryIndex.slugs[tag]+"-1.html")
+			url = doc.primaryIndex.termURL(tagsTaxonomy.name, tag)
 		}
 		tags = append(tags, map[string]string{
 			"tag": tag,
@@ -311,6 +424,20 @@ func (doc *document) frontMatter() templateData {
 		})
 	}
 	data["tags"] = tags
+	for _, t := range doc.conf.taxonomies {
+		terms := []map[string]string{}
+		for _, term := range doc.taxonomyTerms(t) {
+			url := ""
+			if doc.primaryIndex != nil {
+				url = doc.primaryIndex.termURL(t.name, term)
+			}
+			terms = append(terms, map[string]string{
+				"term": term,
+				"url":  url,
+			})
+		}
+		data[t.name] = terms
+	}
 	// prev/next were assigned when the indexes were built.
 	if doc.prev != nil {
 		data["prev"] = templateData{"url": doc.prev.url}
@@ -319,13 +446,14 @@ func (doc *document) frontMatter() templateData {
 		data["next"] = templateData{"url": doc.next.url}
 	}
 	// Merge document front matter user variable into the lower precedence config user variable.
-	user := copyMap(doc.conf.user)
-	mergeMap(user, doc.user)
+	user := deepCopyMap(doc.conf.user)
+	deepMergeMap(user, doc.user)
 	data["user"] = user
+	data["data"] = doc.site.data
 	// Process description as a text template before rendering to HTML.
 	description := doc.description
 	if doc.site.match(doc.contentPath, doc.templates) {
-		description, _ = doc.site.textTemplates.render("documentDescription", description, data)
+		description, _ = doc.site.textTemplates.render("documentDescription", description, data, doc.funcs())
 	}
 	data["description"] = doc.render(description)
 	return data
@@ -333,24 +461,47 @@ func (doc *document) frontMatter() templateData {
 
 // Return front matter as YAML formatted string.
 func (doc *document) String() (result string) {
-	d, _ := yaml.Marshal(doc.frontMatter())
+	data := doc.frontMatter()
+	delete(data, "data") // Site-wide data is not front matter.
+	d, _ := yaml.Marshal(data)
 	return string(d)
 }
 
 // Render document markup to HTML.
 func (doc *document) render(text string) template.HTML {
-	// Render document.
+	return doc.site.renderMarkup(text, filepath.Ext(doc.contentPath))
+}
+
+// funcs returns the template functions bound to the document's configuration
+// and markup.
+func (doc *document) funcs() map[string]interface{} {
+	ext := filepath.Ext(doc.contentPath)
+	if ext != ".rmu" {
+		ext = ".md" // Static files.
+	}
+	return doc.site.contextFuncs(doc.conf, ext)
+}
+
+// renderMarkup renders Markdown (ext is ".md") or Rimu (ext is ".rmu") markup
+// text to HTML.
+func (site *site) renderMarkup(text, ext string) template.HTML {
 	var html string
-	switch filepath.Ext(doc.contentPath) {
+	switch ext {
 	case ".md":
 		opts := blackfriday.WithExtensions(blackfriday.AutoHeadingIDs | blackfriday.CommonExtensions)
 		html = string(blackfriday.Run([]byte(text), opts))
 	case ".rmu":
-		conf, err := fsx.ReadFile(filepath.Join(doc.site.contentDir, "config.rmu"))
+		f := filepath.Join(site.contentDir, "config.rmu")
+		conf, err := site.vfs(f).ReadFile(f)
 		if err == nil {
 			text = conf + "\n\n" + text
 		}
+		rimuMutex.Lock()
 		html = rimu.Render(text, rimu.RenderOptions{Reset: true})
+		rimuMutex.Unlock()
+	}
+	if site.confs[0].highlight != "" {
+		html = highlightCode(html)
 	}
 	return template.HTML(html)
 }
@@ -364,19 +515,53 @@ func (doc *document) updateFrom(src document) {
 	doc.templatePath = src.templatePath
 	doc.content = src.content
 	doc.modtime = src.modtime
+	doc.hash = src.hash
 	doc.title = src.title
 	doc.date = src.date
+	doc.expires = src.expires
 	doc.author = src.author
 	doc.templates = src.templates
 	doc.permalink = src.permalink
 	doc.description = src.description
 	doc.url = src.url
+	doc.aliases = src.aliases
+	doc.aliasPaths = src.aliasPaths
+	doc.resources = src.resources
 	doc.tags = src.tags
+	doc.terms = src.terms
 	doc.draft = src.draft
+	doc.sitemap = src.sitemap
+	doc.search = src.search
+	doc.weight = src.weight
+	doc.series = src.series
+	doc.seriesPart = src.seriesPart
 	doc.slug = src.slug
 	doc.layout = src.layout
 	doc.id = src.id
-	doc.user = copyMap(src.user)
+	doc.user = deepCopyMap(src.user)
+}
+
+// seriesData returns the document's series template data.
+func (doc *document) seriesData() templateData {
+	i := 0
+	for i < len(doc.seriesDocs) && doc.seriesDocs[i] != doc {
+		i++
+	}
+	data := templateData{
+		"title":    doc.series,
+		"position": strconv.Itoa(i + 1),
+		"count":    strconv.Itoa(len(doc.seriesDocs)),
+		"docs":     doc.seriesDocs.frontMatter()["docs"],
+	}
+	if i > 0 {
+		prev := doc.seriesDocs[i-1]
+		data["prev"] = templateData{"url": prev.url, "title": prev.title}
+	}
+	if i < len(doc.seriesDocs)-1 {
+		next := doc.seriesDocs[i+1]
+		data["next"] = templateData{"url": next.url, "title": next.title}
+	}
+	return data
 }
 
 // isDraft returns true if document is a draft and the drafts option is not true.
@@ -384,6 +569,32 @@ func (doc *document) isDraft() bool {
 	return doc.draft && !doc.site.drafts
 }
 
+// isFuture returns true if the document publication date is in the future and
+// the future option is not true.
+func (doc *document) isFuture() bool {
+	return doc.date.After(time.Now()) && !doc.site.future
+}
+
+// isExpired returns true if the document expiry date has passed.
+func (doc *document) isExpired() bool {
+	return !doc.expires.IsZero() && !doc.expires.After(time.Now())
+}
+
+// skipReason returns the reason an unpublished document is excluded from the
+// build: "draft", "future" or "expired". Published documents return a blank
+// string.
+func (doc *document) skipReason() string {
+	switch {
+	case doc.isDraft():
+		return "draft"
+	case doc.isFuture():
+		return "future"
+	case doc.isExpired():
+		return "expired"
+	}
+	return ""
+}
+
 /*
 	An ordered list of document pointers.
 */
@@ -413,6 +624,28 @@ func (docs documentsList) sortByDate() {
 	})
 }
 
+// sortBy sorts documents by the `sort` configuration variable order. Documents
+// with equal sort keys are ordered by date descending.
+func (docs documentsList) sortBy(order string) {
+	docs.sortByDate()
+	var less func(d1, d2 *document) bool
+	switch order {
+	case "date-asc":
+		less = func(d1, d2 *document) bool { return d1.date.Before(d2.date) }
+	case "title":
+		less = func(d1, d2 *document) bool { return strings.ToLower(d1.title) < strings.ToLower(d2.title) }
+	case "weight":
+		less = func(d1, d2 *document) bool { return d1.weight < d2.weight }
+	case "filename":
+		less = func(d1, d2 *document) bool { return d1.contentPath < d2.contentPath }
+	default:
+		return
+	}
+	sort.SliceStable(docs, func(i, j int) bool {
+		return less(docs[i], docs[j])
+	})
+}
+
 // delete deletes document from docs and returns resulting slice. Panics if
 // document not in slice.
 func (docs documentsList) delete(doc *document) documentsList {
@@ -445,16 +678,17 @@ func (docs documentsList) frontMatter() templateData {
 
 /*
 	documentsLookup implements fast indexed retrieval of documents by contentPath,
-	buildPath and id.
+	buildPath, alias build path and id.
 */
 type documentsLookup struct {
 	byBuildPath   map[string]*document // Documents keyed by buildPath.
 	byContentPath map[string]*document // Documents keyed by contentPath.
 	byID          map[string]*document // Documents keyed by id.
+	byAliasPath   map[string]*document // Documents keyed by aliasPaths.
 }
 
 func newDocumentsLookup() documentsLookup {
-	return documentsLookup{map[string]*document{}, map[string]*document{}, map[string]*document{}}
+	return documentsLookup{map[string]*document{}, map[string]*document{}, map[string]*document{}, map[string]*document{}}
 }
 
 func (lookup *documentsLookup) add(doc *document) error {
@@ -462,6 +696,19 @@ func (lookup *documentsLookup) add(doc *document) error {
 	if d != nil {
 		return fmt.Errorf("\"%s\": duplicate document build path in: \"%s\"", doc.contentPath, d.contentPath)
 	}
+	d = lookup.byAliasPath[doc.buildPath]
+	if d != nil {
+		return fmt.Errorf("\"%s\": document build path is an alias in: \"%s\"", doc.contentPath, d.contentPath)
+	}
+	for _, p := range doc.aliasPaths {
+		d = lookup.byBuildPath[p]
+		if d == nil {
+			d = lookup.byAliasPath[p]
+		}
+		if d != nil {
+			return fmt.Errorf("\"%s\": duplicate alias build path \"%s\" in: \"%s\"", doc.contentPath, p, d.contentPath)
+		}
+	}
 	d = lookup.byContentPath[doc.contentPath]
 	if d != nil {
 		panic(doc.contentPath + "%s: lookup already contains this document")
@@ -477,6 +724,9 @@ func (lookup *documentsLookup) add(doc *document) error {
 	if doc.id != nil && *doc.id != "" {
 		lookup.byID[*doc.id] = doc
 	}
+	for _, p := range doc.aliasPaths {
+		lookup.byAliasPath[p] = doc
+	}
 	return nil
 }
 
@@ -493,6 +743,40 @@ func (lookup *documentsLookup) delete(doc *document) {
 	if doc.id != nil && *doc.id != "" {
 		deleteKey(lookup.byID, *doc.id, doc)
 	}
+	for _, p := range doc.aliasPaths {
+		deleteKey(lookup.byAliasPath, p, doc)
+	}
+}
+
+// setSeries assigns documents belonging to a series the series documents
+// ordered by series part. Documents without a series part follow the numbered
+// parts in publication date order.
+func (lookup *documentsLookup) setSeries() {
+	series := map[string]documentsList{}
+	for _, doc := range lookup.byContentPath {
+		doc.seriesDocs = nil
+		if doc.series != "" {
+			series[doc.series] = append(series[doc.series], doc)
+		}
+	}
+	for _, docs := range series {
+		sort.Slice(docs, func(i, j int) bool {
+			d1, d2 := docs[i], docs[j]
+			switch {
+			case d1.seriesPart != d2.seriesPart && (d1.seriesPart == 0 || d2.seriesPart == 0):
+				return d2.seriesPart == 0
+			case d1.seriesPart != d2.seriesPart:
+				return d1.seriesPart < d2.seriesPart
+			case !d1.date.Equal(d2.date):
+				return d1.date.Before(d2.date)
+			default:
+				return d1.contentPath < d2.contentPath
+			}
+		})
+		for _, doc := range docs {
+			doc.seriesDocs = docs
+		}
+	}
 }
 
 func (lookup *documentsLookup) update(doc *document, from document) error {
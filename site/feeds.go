@@ -0,0 +1,154 @@
+package site
+
+import (
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// Built-in feed templates. They can be overridden by a `feed.xml` text
+// template in the index template directory.
+var feedTemplates = map[string]string{
+	"atom": `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <title>{{.title | html}}</title>
+  <link href="{{.url | html}}"/>
+  <link rel="self" href="{{.feedurl | html}}"/>
+  <id>{{.url | html}}</id>
+  <updated>{{.updated}}</updated>
+{{- range .docs}}
+  <entry>
+    <title>{{.title | html}}</title>
+    <link href="{{.url | html}}"/>
+    <id>{{.url | html}}</id>
+    <updated>{{.updated}}</updated>
+    {{- if .author}}
+    <author><name>{{.author | html}}</name></author>
+    {{- end}}
+    <summary type="html">{{.description | html}}</summary>
+  </entry>
+{{- end}}
+</feed>
+`,
+	"rss": `<?xml version="1.0" encoding="utf-8"?>
+<rss version="2.0" xmlns:atom="http://www.w3.org/2005/Atom" xmlns:dc="http://purl.org/dc/elements/1.1/">
+  <channel>
+    <title>{{.title | html}}</title>
+    <link>{{.url | html}}</link>
+    <atom:link href="{{.feedurl | html}}" rel="self" type="application/rss+xml"/>
+    <description>{{.title | html}}</description>
+    <lastBuildDate>{{.updated}}</lastBuildDate>
+{{- range .docs}}
+    <item>
+      <title>{{.title | html}}</title>
+      <link>{{.url | html}}</link>
+      <guid>{{.url | html}}</guid>
+      <pubDate>{{.updated}}</pubDate>
+      {{- if .author}}
+      <dc:creator>{{.author | html}}</dc:creator>
+      {{- end}}
+      <description>{{.description | html}}</description>
+    </item>
+{{- end}}
+  </channel>
+</rss>
+`,
+}
+
+// feedDateFormats are the feed entry date formats.
+var feedDateFormats = map[string]string{
+	"atom": time.RFC3339,
+	"rss":  time.RFC1123Z,
+}
+
+// renderFeeds renders the index feeds configured by the `feeds` configuration
+// variable. Per-term feeds are rendered for each of the index's taxonomy indexes.
+// Feed files are written with the writeFile function.
+func (idx *index) renderFeeds(writeFile func(f, text string) error) error {
+	for _, format := range idx.conf.feeds {
+		f := filepath.Join(idx.indexDir, "feed."+format)
+		if err := idx.renderFeed(format, f, idx.docs, taxonomy{}, "", writeFile); err != nil {
+			return err
+		}
+		for _, t := range idx.conf.allTaxonomies() {
+			ti := idx.taxonomies[t.name]
+			if ti == nil {
+				continue
+			}
+			for _, term := range sortedKeys(ti.docs) {
+				f := filepath.Join(idx.indexDir, t.name, ti.slugs[term]+"."+format)
+				if err := idx.renderFeed(format, f, ti.docs[term], t, term, writeFile); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// renderFeed renders a feed of the most recent docs to file f. t and term are
+// blank unless the feed is a per-term feed.
+func (idx *index) renderFeed(format, f string, docs documentsList, t taxonomy, term string, writeFile func(f, text string) error) error {
+	site := idx.site // Lexical shortcut.
+	if idx.conf.sort != "date-desc" {
+		docs = append(documentsList{}, docs...)
+		docs.sortByDate()
+	}
+	if n := idx.conf.feedsize; n > 0 && len(docs) > n {
+		docs = docs[:n]
+	}
+	dateFormat := feedDateFormats[format]
+	updated := time.Time{}
+	entries := []templateData{}
+	for _, doc := range docs {
+		if doc.date.After(updated) {
+			updated = doc.date
+		}
+		fm := doc.frontMatter()
+		entries = append(entries, templateData{
+			"title":       doc.title,
+			"url":         site.absURL(doc.url),
+			"author":      nz(doc.author),
+			"description": fm["description"],
+			"date":        doc.date,
+			"updated":     doc.date.In(idx.conf.timezone).Format(dateFormat),
+		})
+	}
+	title := path.Base(idx.url)
+	url := rootRelURL(idx.url, "docs-1.html")
+	tag := ""
+	if term != "" {
+		title += ": " + term
+		url = idx.termURL(t.name, term)
+		if t == tagsTaxonomy {
+			tag = term
+		}
+	}
+	data := templateData{
+		"format":    format,
+		"title":     title,
+		"tag":       tag,
+		"taxonomy":  t.name,
+		"term":      term,
+		"url":       site.absURL(url),
+		"feedurl":   site.absURL(rootRelURL(relPath(f, site.buildDir))),
+		"updated":   updated.In(idx.conf.timezone).Format(dateFormat),
+		"docs":      entries,
+		"urlprefix": idx.conf.urlprefix,
+		"user":      idx.conf.user,
+		"data":      site.data,
+	}
+	var text string
+	var err error
+	tmpl := site.textTemplates.name(idx.templateDir, "feed.xml")
+	if site.textTemplates.contains(tmpl) {
+		text, err = site.textTemplates.execute(tmpl, data, idx.funcs())
+	} else {
+		text, err = site.textTemplates.render("feed."+format, feedTemplates[format], data, idx.funcs())
+	}
+	if err != nil {
+		return err
+	}
+	site.logVerbose2("write feed: \"%s\"", f)
+	return writeFile(f, text)
+}
@@ -0,0 +1,125 @@
+package site
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/srackham/hindsite/v2/fsx"
+)
+
+/*
+Static files matching the root configuration `fingerprint` patterns are written
+with a content hash inserted in their build file names e.g. `main.css` is
+written as `main.1f3a5b7c.css`. Fingerprinting is disabled by the serve command
+so that LiveReload can hot-swap style sheets.
+*/
+
+// fingerprintManifest is the name of the build directory file that maps
+// original static file build paths to fingerprinted build paths.
+const fingerprintManifest = "fingerprints.json"
+
+// isFingerprinting returns true if static files are fingerprinted.
+func (site *site) isFingerprinting() bool {
+	return site.command == "build" && strings.TrimSpace(strings.Join(site.confs[0].fingerprint, "")) != ""
+}
+
+// isFingerprinted returns true if content static file f is fingerprinted.
+func (site *site) isFingerprinted(f string) bool {
+	return site.isFingerprinting() && site.match(f, site.confs[0].fingerprint)
+}
+
+// fingerprintPath returns the fingerprinted build path of content static file f
+// with build path dst and contents. The fingerprinted URL is recorded in the
+// site fingerprints. dst is returned if f is not fingerprinted.
+func (site *site) fingerprintPath(f, dst, contents string) string {
+	if !site.isFingerprinted(f) {
+		return dst
+	}
+	result := fsx.ReplaceExt(dst, "."+hashOf(contents)[:8]+filepath.Ext(dst))
+	site.setFingerprint(dst, result)
+	return result
+}
+
+// setFingerprint records fingerprinted build path fp of build file dst.
+func (site *site) setFingerprint(dst, fp string) {
+	site.fingerprints[rootRelURL(relPath(dst, site.buildDir))] = rootRelURL(relPath(fp, site.buildDir))
+}
+
+// fingerprintedPath returns the fingerprinted build path of build file dst (dst
+// if the file is not fingerprinted).
+func (site *site) fingerprintedPath(dst string) string {
+	if u, ok := site.fingerprints[rootRelURL(relPath(dst, site.buildDir))]; ok {
+		return filepath.Join(site.buildDir, filepath.FromSlash(strings.TrimPrefix(u, "/")))
+	}
+	return dst
+}
+
+// fingerprintURL returns the fingerprinted URL of the static file with
+// root-relative URL u (u if the file is not fingerprinted). URLs prefixed with
+// the site `urlprefix` are also resolved.
+func (site *site) fingerprintURL(u string) string {
+	prefix := site.urlprefix()
+	if prefix != "" && strings.HasPrefix(u, prefix+"/") {
+		return prefix + site.fingerprintURL(strings.TrimPrefix(u, prefix))
+	}
+	i := strings.IndexAny(u, "?#")
+	if i == -1 {
+		i = len(u)
+	}
+	if fp, ok := site.fingerprints[u[:i]]; ok {
+		return fp + u[i:]
+	}
+	return u
+}
+
+// fingerprint returns the fingerprinted URL of the static file with
+// root-relative URL u prefixed with the site `urlprefix`.
+func (site *site) fingerprint(u string) string {
+	return site.urlize(site.fingerprintURL(u))
+}
+
+// fingerprintsHash returns a hash of the site fingerprints.
+func (site *site) fingerprintsHash() string {
+	values := []string{}
+	for u, fp := range site.fingerprints {
+		values = append(values, u+" "+fp)
+	}
+	sort.Strings(values)
+	return hashOf(values...)
+}
+
+// injectFingerprints replaces the URLs in HTML href and src attributes that
+// reference fingerprinted static files with fingerprinted URLs.
+func (site *site) injectFingerprints(html string) string {
+	if len(site.fingerprints) == 0 {
+		return html
+	}
+	re := regexp.MustCompile(`(?i)((?:href|src)=")([^"]+)"`)
+	return re.ReplaceAllStringFunc(html, func(match string) string {
+		m := re.FindStringSubmatch(match)
+		return m[1] + site.fingerprintURL(m[2]) + `"`
+	})
+}
+
+// buildFingerprintManifest writes the fingerprint manifest JSON file to the
+// root of the build directory. The manifest maps build directory relative
+// static file paths to their fingerprinted paths.
+func (site *site) buildFingerprintManifest() error {
+	if !site.isFingerprinting() {
+		return nil
+	}
+	manifest := map[string]string{}
+	for u, fp := range site.fingerprints {
+		manifest[strings.TrimPrefix(u, "/")] = strings.TrimPrefix(fp, "/")
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	f := filepath.Join(site.buildDir, fingerprintManifest)
+	site.logVerbose("write fingerprints: \"%s\"", f)
+	return site.buildFS.WriteFile(f, data)
+}
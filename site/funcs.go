@@ -0,0 +1,186 @@
+package site
+
+import (
+	"fmt"
+	"html/template"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// templateFuncs returns the function library shared by HTML and text
+// templates. Functions that transform a string take it as their last argument
+// so they can be used in template pipelines e.g. `{{.title | truncate 20}}`.
+// The context dependent functions are bound to the root configuration and
+// Markdown, they are rebound to the rendered document or index when templates
+// are executed (see contextFuncs).
+func (site *site) templateFuncs() map[string]interface{} {
+	funcs := map[string]interface{}{
+		// Strings.
+		"slugify": func(s string) string {
+			return slugify(s, nil)
+		},
+		"truncate": truncate,
+		"lower":    strings.ToLower,
+		"upper":    strings.ToUpper,
+		"title": func(s string) string {
+			//lint:ignore SA1019 titles are not language specific
+			return strings.Title(s)
+		},
+		"trim": strings.TrimSpace,
+		"replace": func(old, new, s string) string {
+			return strings.ReplaceAll(s, old, new)
+		},
+		"contains": func(substr, s string) bool {
+			return strings.Contains(s, substr)
+		},
+		"hasPrefix": func(prefix, s string) bool {
+			return strings.HasPrefix(s, prefix)
+		},
+		"hasSuffix": func(suffix, s string) bool {
+			return strings.HasSuffix(s, suffix)
+		},
+		"split": func(sep, s string) []string {
+			return strings.Split(s, sep)
+		},
+		"join": join,
+		// Arithmetic.
+		"add": func(a, b int) int { return a + b },
+		"sub": func(a, b int) int { return a - b },
+		"mul": func(a, b int) int { return a * b },
+		"div": func(a, b int) (int, error) {
+			if b == 0 {
+				return 0, fmt.Errorf("div: division by zero")
+			}
+			return a / b, nil
+		},
+		"mod": func(a, b int) (int, error) {
+			if b == 0 {
+				return 0, fmt.Errorf("mod: division by zero")
+			}
+			return a % b, nil
+		},
+		// URLs.
+		"urlize": site.urlize,
+		"absURL": site.absoluteURL,
+		// Images.
+		"srcset":    site.srcset,
+		"thumbnail": site.thumbnail,
+		// Assets.
+		"fingerprint": site.fingerprint,
+		// Safe content casts (bypass html/template escaping).
+		"safeHTML":     func(s string) template.HTML { return template.HTML(s) },
+		"safeJS":       func(s string) template.JS { return template.JS(s) },
+		"safeCSS":      func(s string) template.CSS { return template.CSS(s) },
+		"safeURL":      func(s string) template.URL { return template.URL(s) },
+		"safeHTMLAttr": func(s string) template.HTMLAttr { return template.HTMLAttr(s) },
+	}
+	for name, f := range site.contextFuncs(site.confs[0], ".md") {
+		funcs[name] = f
+	}
+	return funcs
+}
+
+// contextFuncs returns the template functions that depend on the rendering
+// context: `dateFormat` defaults to the configuration conf `timezone` and
+// `markdownify` renders markup with file name extension ext (".md" or ".rmu").
+func (site *site) contextFuncs(conf config, ext string) map[string]interface{} {
+	return map[string]interface{}{
+		"dateFormat": func(layout string, date interface{}, tz ...string) (string, error) {
+			return dateFormat(conf.timezone, layout, date, tz...)
+		},
+		"markdownify": func(s string) template.HTML {
+			return site.renderMarkup(s, ext)
+		},
+	}
+}
+
+// dateFormat formats date (a time.Time or a date string) using the Go time
+// layout. The date is converted to the optional time zone location, if it is
+// not specified the default location loc is used.
+func dateFormat(loc *time.Location, layout string, date interface{}, tz ...string) (string, error) {
+	if len(tz) > 0 && tz[0] != "" {
+		var err error
+		if loc, err = time.LoadLocation(tz[0]); err != nil {
+			return "", fmt.Errorf("dateFormat: %s", err.Error())
+		}
+	}
+	var t time.Time
+	switch d := date.(type) {
+	case time.Time:
+		t = d
+	case string:
+		var err error
+		if t, err = parseDate(d, loc); err != nil {
+			return "", fmt.Errorf("dateFormat: %s", err.Error())
+		}
+	default:
+		return "", fmt.Errorf("dateFormat: illegal date: %v", date)
+	}
+	return t.In(loc).Format(layout), nil
+}
+
+// urlize prefixes root-relative URL u with the `urlprefix`. URLs that are
+// already prefixed and URLs that are not root-relative are returned unchanged.
+func (site *site) urlize(u string) string {
+	prefix := site.urlprefix()
+	if !strings.HasPrefix(u, "/") || strings.HasPrefix(u, "//") {
+		return u
+	}
+	if prefix != "" && (u == prefix || strings.HasPrefix(u, prefix+"/")) {
+		return u
+	}
+	return prefix + u
+}
+
+// absoluteURL returns the absolute URL of root-relative URL u by prefixing it
+// with the `urlprefix`. URLs with a scheme or host are returned unchanged. An
+// error is returned if the `urlprefix` is not absolute.
+func (site *site) absoluteURL(u string) (string, error) {
+	if strings.Contains(u, "://") || strings.HasPrefix(u, "//") {
+		return u, nil
+	}
+	if !strings.HasPrefix(u, "/") {
+		return "", fmt.Errorf("absURL: URL is not root-relative: \"%s\"", u)
+	}
+	if !strings.HasPrefix(site.urlprefix(), "http") {
+		return "", fmt.Errorf("absURL: requires an absolute urlprefix: \"%s\"", site.urlprefix())
+	}
+	return site.urlize(u), nil
+}
+
+// truncate truncates s to length characters. Truncated strings are suffixed
+// with an ellipsis.
+func truncate(length int, s string) string {
+	if utf8.RuneCountInString(s) <= length {
+		return s
+	}
+	runes := []rune(s)
+	return strings.TrimSpace(string(runes[:length])) + "…"
+}
+
+// join joins list items with separator sep. Maps with a "tag" key (e.g. the
+// document `.tags` variable) are joined by their tag, other maps (e.g. document
+// taxonomy variables) are joined by their "term" key.
+func join(sep string, list interface{}) (string, error) {
+	items := []string{}
+	switch l := list.(type) {
+	case []string:
+		items = l
+	case []map[string]string:
+		for _, m := range l {
+			if tag, ok := m["tag"]; ok {
+				items = append(items, tag)
+			} else {
+				items = append(items, m["term"])
+			}
+		}
+	case []interface{}:
+		for _, v := range l {
+			items = append(items, fmt.Sprint(v))
+		}
+	default:
+		return "", fmt.Errorf("join: illegal list: %v", list)
+	}
+	return strings.Join(items, sep), nil
+}
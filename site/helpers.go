@@ -63,6 +63,37 @@ func mergeMap[T any](dst map[string]T, maps ...map[string]T) {
 	}
 }
 
+// deepCopyMap returns a copy of a map and its nested maps.
+func deepCopyMap(m map[string]interface{}) (result map[string]interface{}) {
+	result = map[string]interface{}{}
+	for k, v := range m {
+		if child, ok := v.(map[string]interface{}); ok {
+			v = deepCopyMap(child)
+		}
+		result[k] = v
+	}
+	return
+}
+
+// deepMergeMap merges maps into dst map. Nested maps are merged recursively,
+// all other values (including lists) are replaced. Merged nested maps are
+// copied so dst does not share them with the source maps.
+func deepMergeMap(dst map[string]interface{}, maps ...map[string]interface{}) {
+	for _, m := range maps {
+		for k, v := range m {
+			if src, ok := v.(map[string]interface{}); ok {
+				if child, ok := dst[k].(map[string]interface{}); ok {
+					deepMergeMap(child, src)
+				} else {
+					dst[k] = deepCopyMap(src)
+				}
+			} else {
+				dst[k] = v
+			}
+		}
+	}
+}
+
 // rootRelURL joins path elements and prefixes them with "/".
 func rootRelURL(elem ...string) string {
 	return "/" + path.Join(elem...)
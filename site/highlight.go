@@ -0,0 +1,82 @@
+package site
+
+import (
+	"html"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/srackham/hindsite/v2/highlight"
+)
+
+// codeBlockRe matches HTML code blocks rendered from Markdown and Rimu fenced
+// code blocks.
+var codeBlockRe = regexp.MustCompile(`(?s)<pre( class="[^"]*")?><code( class="[^"]*")?>(.*?)</code></pre>`)
+
+// languageRe extracts the code block language from a class attribute.
+var languageRe = regexp.MustCompile(`\blanguage-([\w#+-]+)`)
+
+// classRe extracts the class names from a class attribute.
+var classRe = regexp.MustCompile(`^ class="([^"]*)"$`)
+
+// codeLanguage returns the language of a code block from its `pre` and `code`
+// element class attributes (blank if there is none). Markdown renders the
+// language as a `language-<name>` class on the `code` element, Rimu renders it
+// as a `<name>` class on the `pre` element.
+func codeLanguage(preClass, codeClass string) string {
+	if lang := languageRe.FindStringSubmatch(codeClass); lang != nil {
+		return lang[1]
+	}
+	if lang := languageRe.FindStringSubmatch(preClass); lang != nil {
+		return lang[1]
+	}
+	if m := classRe.FindStringSubmatch(preClass); m != nil {
+		for _, name := range strings.Fields(m[1]) {
+			if highlight.Supported(name) {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// highlightCode syntax highlights HTML code blocks whose language is
+// specified by a `language-<name>` class on the `pre` or `code` element or by
+// a supported language class on the `pre` element. The `highlight` class is
+// added to the `pre` element of highlighted code blocks.
+func highlightCode(text string) string {
+	return codeBlockRe.ReplaceAllStringFunc(text, func(block string) string {
+		m := codeBlockRe.FindStringSubmatch(block)
+		preClass, codeClass, code := m[1], m[2], m[3]
+		lang := codeLanguage(preClass, codeClass)
+		if lang == "" {
+			return block
+		}
+		result, ok := highlight.Highlight(html.UnescapeString(code), lang)
+		if !ok {
+			return block
+		}
+		if preClass == "" {
+			preClass = ` class="highlight"`
+		} else {
+			preClass = strings.TrimSuffix(preClass, `"`) + ` highlight"`
+		}
+		return "<pre" + preClass + "><code" + codeClass + ">" + result + "</code></pre>"
+	})
+}
+
+// buildHighlightCSS writes the `highlight` configuration variable theme style
+// sheet to `highlight.css` in the root of the build directory. The style
+// sheet is not written if there is one in the content directory.
+func (site *site) buildHighlightCSS() error {
+	if f := filepath.Join(site.contentDir, "highlight.css"); site.vfs(f).FileExists(f) {
+		return nil
+	}
+	css, err := highlight.CSS(site.confs[0].highlight)
+	if err != nil {
+		return err
+	}
+	f := filepath.Join(site.buildDir, "highlight.css")
+	site.logVerbose("write highlight theme: \"%s\"", f)
+	return site.buildFS.WriteFile(f, []byte(css))
+}
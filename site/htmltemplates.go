@@ -4,22 +4,23 @@ import (
 	"bytes"
 	"html/template"
 	"path/filepath"
-
-	"github.com/srackham/hindsite/v2/fsx"
+	"sync"
 )
 
 type templateData map[string]interface{}
 
 type htmlTemplates struct {
 	templateDir string
-	layouts     []string // Layout templates file names.
-	templates   *template.Template
+	layouts     []string           // Layout templates file names.
+	templates   *template.Template // Parsed templates (they are executed as clones).
+	clones      *sync.Pool         // Executable clones of the parsed templates.
 }
 
-func newHTMLTemplates(templateDir string) htmlTemplates {
+func newHTMLTemplates(templateDir string, funcs map[string]interface{}) htmlTemplates {
 	tmpls := htmlTemplates{}
 	tmpls.templateDir = templateDir
-	tmpls.templates = template.New("")
+	tmpls.templates = template.New("").Funcs(funcs)
+	tmpls.clones = &sync.Pool{}
 	return tmpls
 }
 
@@ -39,15 +40,11 @@ func (tmpls htmlTemplates) name(elem ...string) string {
 	return filepath.ToSlash(name)
 }
 
-// add parses the corresponding file from the templates directory and adds it to
+// add parses the text of a file from the templates directory and adds it to
 // templates.
-func (tmpls *htmlTemplates) add(tmplfile string) error {
-	text, err := fsx.ReadFile(tmplfile)
-	if err != nil {
-		return err
-	}
+func (tmpls *htmlTemplates) add(tmplfile, text string) error {
 	name := tmpls.name(tmplfile)
-	if _, err = tmpls.templates.New(name).Parse(text); err != nil {
+	if _, err := tmpls.templates.New(name).Parse(text); err != nil {
 		return err
 	}
 	if filepath.Base(tmplfile) == "layout.html" {
@@ -56,10 +53,22 @@ func (tmpls *htmlTemplates) add(tmplfile string) error {
 	return nil
 }
 
-// render renders named HTML template to a string.
-func (tmpls htmlTemplates) render(name string, data templateData) (string, error) {
+// render renders named HTML template to a string with the template functions
+// overridden by funcs. Templates are executed from a pool of clones so that
+// concurrent renders can bind their own functions.
+// Safe for concurrent use once all templates have been added.
+func (tmpls htmlTemplates) render(name string, data templateData, funcs map[string]interface{}) (string, error) {
+	tmpl, ok := tmpls.clones.Get().(*template.Template)
+	if !ok {
+		var err error
+		if tmpl, err = tmpls.templates.Clone(); err != nil {
+			return "", err
+		}
+	}
+	defer tmpls.clones.Put(tmpl)
+	tmpl.Funcs(funcs)
 	buf := bytes.NewBufferString("")
-	if err := tmpls.templates.ExecuteTemplate(buf, name, data); err != nil {
+	if err := tmpl.ExecuteTemplate(buf, name, data); err != nil {
 		return "", err
 	}
 	return buf.String(), nil
@@ -0,0 +1,252 @@
+package site
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/srackham/hindsite/v2/fsx"
+	"github.com/srackham/hindsite/v2/imagex"
+)
+
+// imageDerivative is a resized copy of a static image file.
+type imageDerivative struct {
+	buildPath string
+	url       string
+	width     int
+	height    int
+	quality   int // JPEG encoding quality (zero if not a JPEG image).
+	thumbnail bool
+}
+
+// imageInfo is a static image file's cached derivatives.
+type imageInfo struct {
+	modtime     time.Time // Source image modification time.
+	derivatives []imageDerivative
+	width       int // Source image width.
+}
+
+// imageDerivatives returns the derivatives of static image file f configured
+// by the `imagewidths` and `thumbnail` configuration variables along with the
+// width of the source image. Images are not enlarged. The results are cached
+// for the duration of the build and are recomputed if the image is modified.
+func (site *site) imageDerivatives(f string) ([]imageDerivative, int, error) {
+	conf := site.configFor(f)
+	if !imagex.Supported(f) || (len(conf.imagewidths) == 0 && conf.thumbnail == [2]int{}) {
+		return nil, 0, nil
+	}
+	info, err := site.vfs(f).Stat(f)
+	if err != nil {
+		return nil, 0, err
+	}
+	site.imagesMutex.Lock()
+	img, ok := site.images[f]
+	site.imagesMutex.Unlock()
+	if ok && img.modtime.Equal(info.ModTime()) {
+		return img.derivatives, img.width, nil
+	}
+	derivatives, width, err := site.readImageDerivatives(f, conf)
+	if err != nil {
+		return nil, 0, err
+	}
+	site.imagesMutex.Lock()
+	if site.images == nil {
+		site.images = map[string]imageInfo{}
+	}
+	site.images[f] = imageInfo{modtime: info.ModTime(), derivatives: derivatives, width: width}
+	site.imagesMutex.Unlock()
+	return derivatives, width, nil
+}
+
+// readImageDerivatives reads the dimensions of static image file f and
+// returns its derivatives along with the width of the source image.
+func (site *site) readImageDerivatives(f string, conf config) (result []imageDerivative, width int, err error) {
+	data, err := site.vfs(f).ReadFile(f)
+	if err != nil {
+		return nil, 0, err
+	}
+	width, height, err := imagex.DecodeConfig(strings.NewReader(data))
+	if err != nil {
+		return nil, 0, fmt.Errorf("\"%s\": %s", f, err.Error())
+	}
+	dst := fsx.PathTranslate(f, site.contentDir, site.buildDir)
+	name := func(suffix string) string {
+		return fsx.ReplaceExt(dst, "-"+suffix+filepath.Ext(dst))
+	}
+	quality := 0
+	if imagex.IsJPEG(f) {
+		quality = conf.jpegquality
+	}
+	for _, w := range conf.imagewidths {
+		if w >= width {
+			continue
+		}
+		result = append(result, imageDerivative{
+			buildPath: name(strconv.Itoa(w) + "w"),
+			width:     w,
+			height:    imagex.Height(width, height, w),
+			quality:   quality,
+		})
+	}
+	if conf.thumbnail != [2]int{} {
+		result = append(result, imageDerivative{
+			buildPath: name("thumb"),
+			width:     conf.thumbnail[0],
+			height:    conf.thumbnail[1],
+			quality:   quality,
+			thumbnail: true,
+		})
+	}
+	for i := range result {
+		result[i].url = rootRelURL(relPath(result[i].buildPath, site.buildDir))
+	}
+	return result, width, nil
+}
+
+// isCurrentDerivative returns true if derivative d of static image file f
+// exists, is not older than f and has the configured dimensions and JPEG
+// quality.
+func (site *site) isCurrentDerivative(f string, d imageDerivative) bool {
+	out, ok := site.buildFS.(fsx.StatOutput)
+	if !ok {
+		return false
+	}
+	src, err := site.vfs(f).Stat(f)
+	if err != nil {
+		return false
+	}
+	dst, err := out.Stat(d.buildPath)
+	if err != nil || dst.ModTime().Before(src.ModTime()) {
+		return false
+	}
+	data, err := out.ReadFile(d.buildPath)
+	if err != nil {
+		return false
+	}
+	width, height, err := imagex.DecodeConfig(bytes.NewReader(data))
+	return err == nil && width == d.width && height == d.height && imagex.Quality(data) == d.quality
+}
+
+// buildImageDerivatives writes the derivatives of static image file f to the
+// build directory. Derivatives that are up to date are skipped (see
+// isCurrentDerivative). Incremental builds skip the derivatives of unchanged
+// images along with the image (see staticHash).
+func (site *site) buildImageDerivatives(f string) error {
+	derivatives, _, err := site.imageDerivatives(f)
+	if err != nil {
+		return err
+	}
+	var src image.Image // Decoded source image.
+	for _, d := range derivatives {
+		if site.isCurrentDerivative(f, d) {
+			site.logVerbose2("skip current image: \"%s\"", d.buildPath)
+			continue
+		}
+		if src == nil {
+			data, err := site.vfs(f).ReadFile(f)
+			if err != nil {
+				return err
+			}
+			if src, err = imagex.Decode(strings.NewReader(data)); err != nil {
+				return fmt.Errorf("\"%s\": %s", f, err.Error())
+			}
+		}
+		var img image.Image
+		if d.thumbnail {
+			img = imagex.Thumbnail(src, d.width, d.height)
+		} else {
+			img = imagex.Resize(src, d.width, d.height)
+		}
+		var buf bytes.Buffer
+		if err := imagex.Encode(&buf, img, d.buildPath, d.quality); err != nil {
+			return err
+		}
+		site.logVerbose("write image: \"%s\"", d.buildPath)
+		if err := site.buildFS.WriteFile(d.buildPath, buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// imageFile returns the content directory path of the static image file with
+// root-relative URL u.
+func (site *site) imageFile(u string) (string, error) {
+	if prefix := site.urlprefix(); prefix != "" && strings.HasPrefix(u, prefix+"/") {
+		u = strings.TrimPrefix(u, prefix)
+	}
+	if !strings.HasPrefix(u, "/") {
+		return "", fmt.Errorf("image URL is not root-relative: \"%s\"", u)
+	}
+	f := filepath.Join(site.contentDir, filepath.FromSlash(path.Clean(u)))
+	if !site.vfs(f).FileExists(f) {
+		return "", fmt.Errorf("missing image file: \"%s\"", f)
+	}
+	return f, nil
+}
+
+// srcset returns a `srcset` attribute value listing the resized derivatives
+// and the original of the static image file with root-relative URL u.
+func (site *site) srcset(u string) (string, error) {
+	f, err := site.imageFile(u)
+	if err != nil {
+		return "", fmt.Errorf("srcset: %s", err.Error())
+	}
+	derivatives, width, err := site.imageDerivatives(f)
+	if err != nil {
+		return "", fmt.Errorf("srcset: %s", err.Error())
+	}
+	result := []string{}
+	for _, d := range derivatives {
+		if !d.thumbnail {
+			result = append(result, site.urlize(d.url)+" "+strconv.Itoa(d.width)+"w")
+		}
+	}
+	if len(result) == 0 {
+		return "", nil
+	}
+	result = append(result, site.urlize(rootRelURL(relPath(f, site.contentDir)))+" "+strconv.Itoa(width)+"w")
+	return strings.Join(result, ", "), nil
+}
+
+// thumbnail returns the URL of the thumbnail of the static image file with
+// root-relative URL u.
+func (site *site) thumbnail(u string) (string, error) {
+	f, err := site.imageFile(u)
+	if err != nil {
+		return "", fmt.Errorf("thumbnail: %s", err.Error())
+	}
+	derivatives, _, err := site.imageDerivatives(f)
+	if err != nil {
+		return "", fmt.Errorf("thumbnail: %s", err.Error())
+	}
+	for _, d := range derivatives {
+		if d.thumbnail {
+			return site.urlize(d.url), nil
+		}
+	}
+	return "", fmt.Errorf("thumbnail: thumbnails are not configured: \"%s\"", f)
+}
+
+// injectSrcset adds `srcset` attributes to HTML `img` elements with
+// root-relative `src` URLs that have resized image derivatives.
+func (site *site) injectSrcset(html string) string {
+	re := regexp.MustCompile(`(?i)<img\s(?:[^>]*?\s)?src="(/[^/"][^"]*)"[^>]*>`)
+	return re.ReplaceAllStringFunc(html, func(match string) string {
+		if strings.Contains(strings.ToLower(match), "srcset=") {
+			return match
+		}
+		u := re.FindStringSubmatch(match)[1]
+		srcset, err := site.srcset(u)
+		if err != nil || srcset == "" {
+			return match
+		}
+		return strings.Replace(match, `src="`+u+`"`, `src="`+u+`" srcset="`+srcset+`"`, 1)
+	})
+}
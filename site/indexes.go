@@ -7,25 +7,35 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/srackham/hindsite/v2/fsx"
 )
 
 type index struct {
-	site        *site                    // Context.
-	conf        config                   // Merged configuration for this index.
-	contentDir  string                   // The directory that contains the indexed documents.
-	templateDir string                   // The directory that contains the index templates.
-	indexDir    string                   // The build directory that the index pages are written to.
-	url         string                   // Index directory relative URL (sans urlprefix).
-	docs        documentsList            // Parsed documents belonging to index.
-	tagDocs     map[string]documentsList // Partitions indexed documents by tag.
-	slugs       map[string]string        // Slugified tags.
-	isPrimary   bool                     // True if this is a primary index.
+	site        *site                     // Context.
+	conf        config                    // Merged configuration for this index.
+	contentDir  string                    // The directory that contains the indexed documents.
+	templateDir string                    // The directory that contains the index templates.
+	indexDir    string                    // The build directory that the index pages are written to.
+	url         string                    // Index directory relative URL (sans urlprefix).
+	docs        documentsList             // Parsed documents belonging to index.
+	taxonomies  map[string]*taxonomyIndex // Taxonomy indexes keyed by taxonomy name.
+	yearDocs    map[string]documentsList  // Partitions indexed documents by publication year e.g. "2016".
+	monthDocs   map[string]documentsList  // Partitions indexed documents by publication month e.g. "2016/10".
+	isPrimary   bool                      // True if this is a primary index.
+	outputs     []string                  // Index page files written by the most recent full index build.
 }
 
 type indexes []*index
 
+// taxonomyIndex partitions index documents by taxonomy term.
+type taxonomyIndex struct {
+	taxonomy
+	docs  map[string]documentsList // Documents keyed by term.
+	slugs map[string]string        // Slugified terms.
+}
+
 // page represents a document index page.
 type page struct {
 	number int    // 1...
@@ -47,11 +57,15 @@ func newIndex(site *site) index {
 // Search templateDir directory for indexed directories and add them to indexes.
 func newIndexes(site *site) (indexes, error) {
 	idxs := indexes{}
-	err := filepath.Walk(site.templateDir, func(f string, info os.FileInfo, err error) error {
+	vfs := site.vfs(site.templateDir)
+	err := vfs.Walk(site.templateDir, func(f string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
-		if info.IsDir() && fsx.FileExists(filepath.Join(f, "docs.html")) {
+		if info.IsDir() && f == site.dataDir {
+			return filepath.SkipDir
+		}
+		if info.IsDir() && vfs.FileExists(filepath.Join(f, "docs.html")) {
 			idx := newIndex(site)
 			idx.templateDir = f
 			p, err := filepath.Rel(site.templateDir, f)
@@ -59,7 +73,7 @@ func newIndexes(site *site) (indexes, error) {
 				return err
 			}
 			idx.contentDir = filepath.Join(site.contentDir, p)
-			if !fsx.DirExists(idx.contentDir) {
+			if !site.vfs(idx.contentDir).DirExists(idx.contentDir) {
 				return fmt.Errorf("missing indexed content directory: \"%s\"", idx.contentDir)
 			}
 			idx.indexDir = filepath.Join(site.indexDir, p)
@@ -99,27 +113,91 @@ func (idxs indexes) addDocument(doc *document) {
 	}
 }
 
-// build builds all indexes. modified is the date of the most recently modified
-// configuration or template file. If any document in the index has been
-// modified since the index was last built then the index must be completely
-// rebuild.
-func (idxs indexes) build() error {
-	for _, idx := range idxs {
-		if err := idx.build(nil); err != nil {
-			return err
+// build builds document and taxonomy index pages.
+// If doc is nil then rebuild entire index.
+// If doc is not nil then only those document index pages containing doc are rendered.
+func (idx *index) build(doc *document) error {
+	if doc == nil {
+		idx.prepare()
+	}
+	return idx.render(doc)
+}
+
+// prepare sorts the index documents then assigns document prev/next and
+// related documents according to the primary index ordering. Index document ordering ensures subsequent
+// derived document taxonomy indexes are also ordered.
+func (idx *index) prepare() {
+	idx.docs.sortBy(idx.conf.sort)
+	if idx.isPrimary {
+		idx.docs.setPrevNext()
+	}
+	tmpls := &idx.site.htmlTemplates // Lexical shortcut.
+	idx.taxonomies = map[string]*taxonomyIndex{}
+	for _, t := range idx.conf.allTaxonomies() {
+		if !tmpls.contains(tmpls.name(idx.templateDir, t.name+".html")) {
+			continue
+		}
+		// Build taxonomy term documents.
+		ti := &taxonomyIndex{taxonomy: t, docs: map[string]documentsList{}}
+		for _, doc := range idx.docs {
+			for _, term := range doc.taxonomyTerms(t) {
+				ti.docs[term] = append(ti.docs[term], doc)
+			}
+		}
+		// Build taxonomy term slugs.
+		ti.slugs = map[string]string{}
+		slugs := []string{}
+		for _, term := range sortedKeys(ti.docs) {
+			slug := slugify(term, slugs)
+			slugs = append(slugs, slug)
+			ti.slugs[term] = slug
+		}
+		idx.taxonomies[t.name] = ti
+	}
+	if tmpls.contains(tmpls.name(idx.templateDir, "archive.html")) {
+		// Build idx.yearDocs[] and idx.monthDocs[]. Undated documents are not
+		// archived.
+		idx.yearDocs = map[string]documentsList{}
+		idx.monthDocs = map[string]documentsList{}
+		for _, doc := range idx.docs {
+			if doc.date.IsZero() {
+				continue
+			}
+			date := doc.date.In(idx.conf.timezone)
+			year := date.Format("2006")
+			month := date.Format("2006/01")
+			idx.yearDocs[year] = append(idx.yearDocs[year], doc)
+			idx.monthDocs[month] = append(idx.monthDocs[month], doc)
 		}
 	}
-	return nil
+	if idx.isPrimary {
+		idx.setRelated()
+	}
 }
 
-// build builds document and tag index pages.
-// If doc is nil then rebuild entire index.
+// render renders the prepared index pages.
+// If doc is nil then render entire index.
 // If doc is not nil then only those document index pages containing doc are rendered.
-func (idx *index) build(doc *document) error {
+func (idx *index) render(doc *document) error {
 	if doc == nil {
 		idx.site.logVerbose("build index: \"%s\"", idx.indexDir)
+		idx.outputs = nil
 	}
 	tmpls := &idx.site.htmlTemplates // Lexical shortcut.
+	// writeFile writes an index file and records it in the index outputs.
+	writeFile := func(f, text string) error {
+		if err := idx.site.buildFS.WriteFile(f, []byte(text)); err != nil {
+			return err
+		}
+		if doc == nil {
+			idx.outputs = append(idx.outputs, f)
+		}
+		return nil
+	}
+	// writePage writes an index page.
+	writePage := func(f, html string) error {
+		return writeFile(f, idx.site.minify(f, idx.site.injectUrlprefix(idx.site.injectFingerprints(html))))
+	}
 	// renderPages renders paginated document pages with named template.
 	// Additional template data is included.
 	renderPages := func(pgs []page, tmpl string, data templateData) error {
@@ -138,93 +216,231 @@ func (idx *index) build(doc *document) error {
 			// Merge applicable configuration variables.
 			fm["urlprefix"] = idx.conf.urlprefix
 			fm["user"] = idx.conf.user
+			fm["data"] = idx.site.data
 			if doc != nil {
 				idx.site.logVerbose("write index: \"%s\"", pg.file)
 			} else {
 				idx.site.logVerbose2("write index: \"%s\"", pg.file)
 			}
-			html, err := tmpls.render(tmpl, fm)
+			html, err := tmpls.render(tmpl, fm, idx.funcs())
 			if err != nil {
 				return err
 			}
-			html = idx.site.injectUrlprefix(html)
-			if err = fsx.WritePath(pg.file, html); err != nil {
+			if err = writePage(pg.file, html); err != nil {
 				return err
 			}
 		}
 		return nil
 	}
-	if doc == nil {
-		// Sort index documents then assign document prev/next according to the
-		// primary index ordering. Index document ordering ensures subsequent
-		// derived document tag indexes are also ordered.
-		idx.docs.sortByDate()
-		if idx.isPrimary {
-			idx.docs.setPrevNext()
-		}
-	}
 	docsTemplate := tmpls.name(idx.templateDir, "docs.html")
-	tagsTemplate := tmpls.name(idx.templateDir, "tags.html")
-	if tmpls.contains(tagsTemplate) {
-		// Build idx.tagDocs[].
-		idx.tagDocs = map[string]documentsList{}
-		for _, doc := range idx.docs {
-			for _, tag := range doc.tags {
-				idx.tagDocs[tag] = append(idx.tagDocs[tag], doc)
+	for _, t := range idx.conf.allTaxonomies() {
+		ti := idx.taxonomies[t.name]
+		if ti == nil {
+			continue
+		}
+		if doc == nil {
+			// Render taxonomy index.
+			data := ti.data(idx)
+			// Merge applicable configuration variables.
+			data["urlprefix"] = idx.conf.urlprefix
+			data["user"] = idx.conf.user
+			data["data"] = idx.site.data
+			outfile := filepath.Join(idx.indexDir, t.name+".html")
+			html, err := tmpls.render(tmpls.name(idx.templateDir, t.name+".html"), data, idx.funcs())
+			if err != nil {
+				return err
+			}
+			idx.site.logVerbose2("write index: \"%s\"", outfile)
+			if err = writePage(outfile, html); err != nil {
+				return err
 			}
 		}
-		// Build index tag slugs.
-		idx.slugs = map[string]string{}
-		slugs := []string{}
-		for _, tag := range sortedKeys(idx.tagDocs) {
-			slug := slugify(tag, slugs)
-			slugs = append(slugs, slug)
-			idx.slugs[tag] = slug
+		// Render per-term document index pages.
+		for _, term := range sortedKeys(ti.docs) {
+			pgs := idx.paginate(ti.docs[term], filepath.Join(t.name, ti.slugs[term]+"-%d.html"))
+			data := templateData{"taxonomy": t.name, "term": term}
+			if t == tagsTaxonomy {
+				data["tag"] = term
+			}
+			if err := renderPages(pgs, docsTemplate, data); err != nil {
+				return err
+			}
 		}
+	}
+	archiveTemplate := tmpls.name(idx.templateDir, "archive.html")
+	if tmpls.contains(archiveTemplate) {
 		if doc == nil {
-			// Render tags index.
-			data := idx.tagsData()
+			// Render archive index.
+			data := idx.archiveData()
 			// Merge applicable configuration variables.
 			data["urlprefix"] = idx.conf.urlprefix
 			data["user"] = idx.conf.user
-			outfile := filepath.Join(idx.indexDir, "tags.html")
-			html, err := tmpls.render(tagsTemplate, data)
+			data["data"] = idx.site.data
+			outfile := filepath.Join(idx.indexDir, "archive.html")
+			html, err := tmpls.render(archiveTemplate, data, idx.funcs())
 			if err != nil {
 				return err
 			}
-			html = idx.site.injectUrlprefix(html)
 			idx.site.logVerbose2("write index: \"%s\"", outfile)
-			if err = fsx.WritePath(outfile, html); err != nil {
+			if err = writePage(outfile, html); err != nil {
+				return err
+			}
+		}
+		// Render per-year and per-month document index pages.
+		for _, year := range sortedKeys(idx.yearDocs) {
+			pgs := idx.paginate(idx.yearDocs[year], filepath.Join("archive", year+"-%d.html"))
+			if err := renderPages(pgs, docsTemplate, templateData{"year": year}); err != nil {
 				return err
 			}
 		}
-		// Render per-tag document index pages.
-		for _, tag := range sortedKeys(idx.tagDocs) {
-			pgs := idx.paginate(idx.tagDocs[tag], filepath.Join("tags", idx.slugs[tag]+"-%d.html"))
-			if err := renderPages(pgs, docsTemplate, templateData{"tag": tag}); err != nil {
+		for _, k := range sortedKeys(idx.monthDocs) {
+			year, month, _ := strings.Cut(k, "/")
+			pgs := idx.paginate(idx.monthDocs[k], filepath.Join("archive", year, month+"-%d.html"))
+			data := templateData{"year": year, "month": month, "monthname": monthName(month)}
+			if err := renderPages(pgs, docsTemplate, data); err != nil {
 				return err
 			}
 		}
 	}
 	// Render document index pages.
 	pgs := idx.paginate(idx.docs, "docs-%d.html")
-	return renderPages(pgs, docsTemplate, templateData{})
+	if err := renderPages(pgs, docsTemplate, templateData{}); err != nil {
+		return err
+	}
+	// Render feeds.
+	return idx.renderFeeds(writeFile)
 }
 
-func (idx index) tagsData() templateData {
-	tags := []map[string]string{} // An array of "tag", "url" key value maps.
-	for tag, docs := range idx.tagDocs {
+// setRelated assigns each index document a list of the other index documents
+// that share tags with it, ranked by the number of shared tags then by date
+// (most recent first). The list length is set by the `related` configuration
+// variable.
+func (idx *index) setRelated() {
+	var tagDocs map[string]documentsList
+	if ti := idx.taxonomies[tagsTaxonomy.name]; ti != nil {
+		tagDocs = ti.docs
+	} else {
+		tagDocs = map[string]documentsList{}
+		for _, doc := range idx.docs {
+			for _, tag := range doc.tags {
+				tagDocs[tag] = append(tagDocs[tag], doc)
+			}
+		}
+	}
+	for _, doc := range idx.docs {
+		doc.related = nil
+		if idx.conf.related <= 0 {
+			continue
+		}
+		shared := map[*document]int{} // Number of tags shared with doc.
+		for _, tag := range doc.tags {
+			for _, d := range tagDocs[tag] {
+				if d != doc {
+					shared[d]++
+				}
+			}
+		}
+		for d := range shared {
+			doc.related = append(doc.related, d)
+		}
+		sort.Slice(doc.related, func(i, j int) bool {
+			d1, d2 := doc.related[i], doc.related[j]
+			switch {
+			case shared[d1] != shared[d2]:
+				return shared[d1] > shared[d2]
+			case !d1.date.Equal(d2.date):
+				return d1.date.After(d2.date)
+			default:
+				return d1.contentPath < d2.contentPath
+			}
+		})
+		if len(doc.related) > idx.conf.related {
+			doc.related = doc.related[:idx.conf.related]
+		}
+	}
+}
+
+// funcs returns the template functions bound to the index configuration.
+func (idx *index) funcs() map[string]interface{} {
+	return idx.site.contextFuncs(idx.conf, ".md")
+}
+
+// termSlug returns the slug of the named taxonomy's term (blank if the index
+// has no taxonomy index).
+func (idx *index) termSlug(name, term string) string {
+	if ti := idx.taxonomies[name]; ti != nil {
+		return ti.slugs[term]
+	}
+	return ""
+}
+
+// termURL returns the URL of the first per-term document index page of the
+// named taxonomy's term.
+func (idx *index) termURL(name, term string) string {
+	return rootRelURL(idx.url, name, idx.termSlug(name, term)+"-1.html")
+}
+
+// data returns the taxonomy index template data: a list of terms sorted
+// alphabetically. The tags taxonomy list is also assigned to `tags` and its
+// items include a `tag` key.
+func (ti *taxonomyIndex) data(idx *index) templateData {
+	terms := []map[string]string{} // An array of "term", "url", "count" key value maps.
+	for term, docs := range ti.docs {
 		data := map[string]string{
-			"tag":   tag,
-			"url":   rootRelURL(idx.url, "tags", idx.slugs[tag]+"-1.html"),
+			"term":  term,
+			"url":   idx.termURL(ti.name, term),
 			"count": strconv.Itoa(len(docs)),
 		}
-		tags = append(tags, data)
+		if ti.taxonomy == tagsTaxonomy {
+			data["tag"] = term
+		}
+		terms = append(terms, data)
 	}
-	sort.Slice(tags, func(i, j int) bool {
-		return strings.ToLower(tags[i]["tag"]) < strings.ToLower(tags[j]["tag"])
+	sort.Slice(terms, func(i, j int) bool {
+		return strings.ToLower(terms[i]["term"]) < strings.ToLower(terms[j]["term"])
 	})
-	return templateData{"tags": tags}
+	result := templateData{"taxonomy": ti.name, "terms": terms}
+	if ti.taxonomy == tagsTaxonomy {
+		result["tags"] = terms
+	}
+	return result
+}
+
+// archiveData returns the archive index template data: a list of years
+// (most recent first), each containing a list of months (most recent first).
+func (idx index) archiveData() templateData {
+	years := []templateData{}
+	keys := sortedKeys(idx.yearDocs)
+	sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+	for _, year := range keys {
+		months := []templateData{}
+		for _, k := range sortedKeys(idx.monthDocs) {
+			y, month, _ := strings.Cut(k, "/")
+			if y != year {
+				continue
+			}
+			months = append([]templateData{{
+				"month": month,
+				"name":  monthName(month),
+				"url":   rootRelURL(idx.url, "archive", year, month+"-1.html"),
+				"count": strconv.Itoa(len(idx.monthDocs[k])),
+			}}, months...)
+		}
+		years = append(years, templateData{
+			"year":   year,
+			"url":    rootRelURL(idx.url, "archive", year+"-1.html"),
+			"count":  strconv.Itoa(len(idx.yearDocs[year])),
+			"months": months,
+		})
+	}
+	return templateData{"years": years}
+}
+
+// monthName returns the English name of a two digit month number e.g. "10"
+// returns "October".
+func monthName(month string) string {
+	m, _ := strconv.Atoi(month)
+	return time.Month(m).String()
 }
 
 // Synthesize index pages.
@@ -74,7 +74,7 @@ func (site *site) init() error {
 			if f == site.templateDir {
 				return nil
 			}
-			if info.IsDir() && f == site.initDir {
+			if info.IsDir() && (f == site.initDir || f == site.dataDir) {
 				return filepath.SkipDir
 			}
 			if info.IsDir() {
@@ -7,7 +7,6 @@ import (
 	"sort"
 	"strings"
 
-	"github.com/srackham/hindsite/v2/fsx"
 	"github.com/srackham/hindsite/v2/set"
 	"github.com/srackham/hindsite/v2/slice"
 )
@@ -28,7 +27,7 @@ func (doc *document) linkTarget(u *urlpkg.URL) (target string) {
 			target = filepath.Join(filepath.Dir(doc.buildPath), decodeURL(matches[1]))
 		}
 	}
-	if target != "" && fsx.DirExists(target) {
+	if target != "" && doc.site.buildFS.DirExists(target) {
 		target = filepath.Join(target, "index.html")
 	}
 	return
@@ -93,7 +92,7 @@ func (site *site) lintChecks() {
 				}
 				url = strings.TrimPrefix(url, site.urlprefix())
 				// Check the target URL file exists.
-				if !fsx.FileExists(target) {
+				if !site.buildFS.FileExists(target) {
 					doc.site.logError("\"%s\": contains link to missing file: \"%s\"", doc.contentPath, target)
 					continue
 				}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"regexp"
 
 	"github.com/fatih/color"
 )
@@ -21,38 +22,63 @@ func colorize(attributes []color.Attribute, fn func()) {
 
 // output prints a line to `out` if `site.verbosity` is greater than equal or
 // equal to `verbosity`. If `site.out` is not nil then the line is written to it
-// instead of `out` (this feature is used for testing purposes).
+// instead of `out` (this feature is used for testing purposes). If `site.silent`
+// is true the line is written to `site.log` (if it is not nil). The caller must
+// hold the `site.logMutex`.
 func (site *site) output(out io.Writer, verbosity int, format string, v ...interface{}) {
 	if site.verbosity >= verbosity {
 		msg := fmt.Sprintf(format, v...)
-		if site.out == nil {
-			fmt.Fprintln(out, msg)
-		} else {
+		switch {
+		case site.out != nil:
 			site.out <- msg
+		case site.silent:
+			if site.log != nil {
+				fmt.Fprintln(site.log, msg)
+			}
+		default:
+			fmt.Fprintln(out, msg)
 		}
 	}
 }
 
+// diagnostic returns a Diagnostic for the formatted message. The diagnostic
+// path is extracted from messages that start with a quoted file path.
+func diagnostic(format string, v ...interface{}) Diagnostic {
+	msg := fmt.Sprintf(format, v...)
+	if m := regexp.MustCompile(`^"([^"]+)": (.*)$`).FindStringSubmatch(msg); m != nil {
+		return Diagnostic{Path: m[1], Message: m[2]}
+	}
+	return Diagnostic{Message: msg}
+}
+
 // logConsole prints a line to stdout.
 func (site *site) logConsole(format string, v ...interface{}) {
+	site.logMutex.Lock()
+	defer site.logMutex.Unlock()
 	site.output(os.Stdout, 0, format, v...)
 }
 
 // logVerbose prints a line to stdout if `-v` logVerbose option was specified.
 func (site *site) logVerbose(format string, v ...interface{}) {
+	site.logMutex.Lock()
+	defer site.logMutex.Unlock()
 	site.output(os.Stdout, 1, format, v...)
 }
 
 // logVerbose2 prints a a line to stdout the `-v` verbose option was specified more
 // than once.
 func (site *site) logVerbose2(format string, v ...interface{}) {
+	site.logMutex.Lock()
+	defer site.logMutex.Unlock()
 	site.output(os.Stdout, 2, format, v...)
 }
 
 // logColorize prints a colorized line to stdout.
 func (site *site) logColorize(attributes []color.Attribute, format string, v ...interface{}) {
+	site.logMutex.Lock()
+	defer site.logMutex.Unlock()
 	colorize(attributes, func() {
-		site.logConsole(format, v...)
+		site.output(os.Stdout, 0, format, v...)
 	})
 }
 
@@ -63,16 +89,33 @@ func (site *site) logHighlight(format string, v ...interface{}) {
 
 // logError prints a line to stderr and increments the error count.
 func (site *site) logError(format string, v ...interface{}) {
+	site.logMutex.Lock()
+	defer site.logMutex.Unlock()
 	colorize(errorColor, func() {
 		site.output(os.Stderr, 0, "error: "+format, v...)
 	})
 	site.errors++
+	site.errorLog = append(site.errorLog, diagnostic(format, v...))
 }
 
 // logWarning prints a line to stdout and increments the warnings count.
 func (site *site) logWarning(format string, v ...interface{}) {
+	site.logMutex.Lock()
+	defer site.logMutex.Unlock()
 	colorize(warningColor, func() {
 		site.output(os.Stdout, 0, "warning: "+format, v...)
 	})
 	site.warnings++
+	site.warningLog = append(site.warningLog, diagnostic(format, v...))
+}
+
+// resetLogs zeroes the error and warning counts and clears the error and
+// warning logs.
+func (site *site) resetLogs() {
+	site.logMutex.Lock()
+	defer site.logMutex.Unlock()
+	site.errors = 0
+	site.warnings = 0
+	site.errorLog = nil
+	site.warningLog = nil
 }
@@ -0,0 +1,101 @@
+package site
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/srackham/hindsite/v2/slice"
+)
+
+// setAliasPaths validates the document `aliases` and assigns the build paths
+// of their redirect pages. Aliases are root-relative URLs; aliases ending with
+// a slash or without a file name extension are written to an `index.html`
+// file in the alias directory.
+func (doc *document) setAliasPaths() error {
+	doc.aliasPaths = nil
+	for _, alias := range doc.aliases {
+		p := path.Clean(alias)
+		if !strings.HasPrefix(alias, "/") || p == "/" || strings.Contains(alias, "..") {
+			return fmt.Errorf("illegal alias: \"%s\"", alias)
+		}
+		f := filepath.Join(doc.site.buildDir, filepath.FromSlash(p))
+		if strings.HasSuffix(alias, "/") || path.Ext(p) == "" {
+			f = filepath.Join(f, "index.html")
+		}
+		if f == doc.buildPath || slice.New(doc.aliasPaths...).Has(f) {
+			return fmt.Errorf("duplicate alias: \"%s\"", alias)
+		}
+		doc.aliasPaths = append(doc.aliasPaths, f)
+	}
+	return nil
+}
+
+// redirectHTML returns an HTML page that redirects to URL u.
+func redirectHTML(u string) string {
+	u = html.EscapeString(u)
+	return `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Redirecting to ` + u + `</title>
+<link rel="canonical" href="` + u + `">
+<meta name="robots" content="noindex">
+<meta http-equiv="refresh" content="0; url=` + u + `">
+</head>
+<body>
+<p>This page has moved to <a href="` + u + `">` + u + `</a>.</p>
+</body>
+</html>
+`
+}
+
+// renderAliases writes the document's alias redirect pages.
+func (site *site) renderAliases(doc *document) error {
+	html := redirectHTML(site.absURL(doc.url))
+	for _, f := range doc.aliasPaths {
+		site.logVerbose("write alias: \"%s\"", f)
+		if err := site.buildFS.WriteFile(f, []byte(html)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buildRedirects writes the document aliases to a server redirects file in
+// the root of the build directory. The `redirects` configuration variable
+// selects the file format: "netlify" writes a Netlify `_redirects` file;
+// "nginx" writes a `redirects.map` file of nginx `map` directive entries.
+func (site *site) buildRedirects() error {
+	var f, format string
+	switch site.confs[0].redirects {
+	case "":
+		return nil
+	case "netlify":
+		f = "_redirects"
+		format = "%s %s 301\n"
+	case "nginx":
+		f = "redirects.map"
+		format = "%s %s;\n"
+	default:
+		panic("illegal redirects: " + site.confs[0].redirects)
+	}
+	// Alias URL paths are prefixed with the path of the `urlprefix`.
+	prefix := ""
+	if u, err := url.Parse(site.urlprefix()); err == nil {
+		prefix = strings.TrimSuffix(u.Path, "/")
+	}
+	var text strings.Builder
+	for _, k := range sortedKeys(site.docs.byContentPath) {
+		doc := site.docs.byContentPath[k]
+		for _, alias := range doc.aliases {
+			fmt.Fprintf(&text, format, prefix+alias, site.absURL(doc.url))
+		}
+	}
+	f = filepath.Join(site.buildDir, f)
+	site.logVerbose("write redirects: \"%s\"", f)
+	return site.buildFS.WriteFile(f, []byte(text.String()))
+}
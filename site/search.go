@@ -0,0 +1,77 @@
+package site
+
+import (
+	"encoding/json"
+	"html"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/srackham/hindsite/v2/slice"
+)
+
+// searchEntry is a search index JSON document entry.
+type searchEntry struct {
+	URL         string   `json:"url"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Tags        []string `json:"tags"`
+	Text        string   `json:"text"`
+}
+
+// buildSearchIndexes writes the JSON search indexes configured by the `search`
+// configuration variable: `search.json` in the root of the build directory
+// lists all site documents; `search.json` in an index directory lists the
+// index documents. Documents with a `search: false` front matter value and the
+// `notfound` page are omitted.
+func (site *site) buildSearchIndexes() error {
+	kinds := slice.New(site.confs[0].search...)
+	if kinds.Has("site") {
+		docs := documentsList{}
+		for _, k := range sortedKeys(site.docs.byContentPath) {
+			docs = append(docs, site.docs.byContentPath[k])
+		}
+		if err := site.writeSearchIndex(filepath.Join(site.buildDir, "search.json"), docs); err != nil {
+			return err
+		}
+	}
+	if kinds.Has("indexes") {
+		for _, idx := range site.idxs {
+			if err := site.writeSearchIndex(filepath.Join(idx.indexDir, "search.json"), idx.docs); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeSearchIndex writes a JSON search index of docs to file f.
+func (site *site) writeSearchIndex(f string, docs documentsList) error {
+	entries := []searchEntry{}
+	for _, doc := range docs {
+		if !doc.search || doc.buildPath == site.notFoundPage() {
+			continue
+		}
+		entries = append(entries, searchEntry{
+			URL:         site.absURL(doc.url),
+			Title:       doc.title,
+			Description: plainText(string(doc.render(doc.description))),
+			Tags:        append([]string{}, doc.tags...),
+			Text:        doc.text,
+		})
+	}
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	site.logVerbose("write search index: \"%s\"", f)
+	return site.buildFS.WriteFile(f, data)
+}
+
+// plainText returns HTML stripped of elements, comments, scripts and styles
+// with entities unescaped and whitespace collapsed.
+func plainText(s string) string {
+	s = regexp.MustCompile(`(?is)<(script|style)\b.*?</(script|style)>|<!--.*?-->`).ReplaceAllString(s, " ")
+	s = regexp.MustCompile(`(?s)<[^>]*>`).ReplaceAllString(s, " ")
+	return strings.Join(strings.Fields(html.UnescapeString(s)), " ")
+}
@@ -8,6 +8,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"sync"
 	"time"
@@ -15,11 +16,16 @@ import (
 	"github.com/fsnotify/fsnotify"
 	"github.com/jaschaephraim/lrserver"
 	"github.com/srackham/hindsite/v2/fsx"
+	"github.com/srackham/hindsite/v2/slice"
 )
 
 const (
 	// watcherLullTime is the watcherFilter debounce time.
 	watcherLullTime time.Duration = 50 * time.Millisecond
+	// scheduleWindow is how soon scheduled publications and expiries are reported.
+	scheduleWindow time.Duration = 7 * 24 * time.Hour
+	// scheduleInterval is how often scheduled publications and expiries are processed.
+	scheduleInterval time.Duration = time.Minute
 	// -navigate option LiveReload navigation plugin.
 	navigatePrefix = "__hindsite_navigate:"
 	navigatePlugin = `function HindsitePlugin() {}
@@ -60,10 +66,17 @@ func newServer(site *site) server {
 	}
 }
 
+// close closes the server quit channel. Only the first close error is
+// retained.
 func (svr *server) close(err error) {
 	svr.mutex.Lock()
+	defer svr.mutex.Unlock()
+	select {
+	case <-svr.quit:
+		return // Already closed.
+	default:
+	}
 	svr.err = err
-	svr.mutex.Unlock()
 	close(svr.quit)
 }
 
@@ -95,6 +108,66 @@ Press the Enter key to print help
 `)
 }
 
+// logSchedule reports future documents that will be published, and published
+// documents that will expire, within the scheduleWindow.
+func (svr *server) logSchedule() {
+	now := time.Now()
+	for _, doc := range svr.upcoming {
+		if doc.date.Before(now.Add(scheduleWindow)) {
+			svr.logConsole("publish soon: \"%s\": %s", doc.contentPath, doc.date.In(svr.confs[0].timezone).Format(time.RFC1123))
+		}
+	}
+	for _, k := range sortedKeys(svr.docs.byContentPath) {
+		doc := svr.docs.byContentPath[k]
+		if !doc.expires.IsZero() && doc.expires.Before(now.Add(scheduleWindow)) {
+			svr.logConsole("expire soon: \"%s\": %s", doc.contentPath, doc.expires.In(svr.confs[0].timezone).Format(time.RFC1123))
+		}
+	}
+}
+
+// setUpcoming removes document file f from the upcoming documents then adds doc
+// if it is future dated (doc is nil if the document file has been removed).
+func (svr *server) setUpcoming(f string, doc *document) {
+	for i, d := range svr.upcoming {
+		if d.contentPath == f {
+			svr.upcoming = append(svr.upcoming[:i], svr.upcoming[i+1:]...)
+			break
+		}
+	}
+	if doc != nil && doc.skipReason() == "future" {
+		svr.upcoming = append(svr.upcoming, doc)
+		if doc.date.Before(time.Now().Add(scheduleWindow)) {
+			svr.logConsole("publish soon: \"%s\": %s", doc.contentPath, doc.date.In(svr.confs[0].timezone).Format(time.RFC1123))
+		}
+	}
+}
+
+// publishScheduled publishes upcoming documents whose date has arrived and
+// unpublishes expired documents. It returns true if any documents were
+// published or unpublished.
+func (svr *server) publishScheduled() (bool, error) {
+	now := time.Now()
+	files := []string{}
+	for _, doc := range svr.upcoming {
+		if !doc.date.After(now) {
+			files = append(files, doc.contentPath)
+		}
+	}
+	for _, k := range sortedKeys(svr.docs.byContentPath) {
+		if doc := svr.docs.byContentPath[k]; doc.isExpired() {
+			files = append(files, doc.contentPath)
+		}
+	}
+	for _, f := range files {
+		svr.logConsole("%s: scheduled: \"%s\"", now.Format("15:04:05"), f)
+		svr.setUpcoming(f, nil) // Re-added by writeFile if it is still upcoming.
+		if err := svr.writeFile(f); err != nil {
+			return true, err
+		}
+	}
+	return len(files) > 0, nil
+}
+
 // setNavigateURL sets the document navigation URL that will be processed by the
 // hindsite plugin in the browser LiveReload client. Does nothing if the
 // -navigate option was not specified or live reload is disabled.
@@ -132,46 +205,53 @@ func (svr *server) saveBrowserURL(h http.Handler) http.Handler {
 }
 
 // htmlFilter server request handler injects the LiveReload script tag into the
-// body and strips the urlprefix from href URLs.
+// body and strips the urlprefix from href URLs. Requests for missing files are
+// answered with the `notfound` page (if it exists).
 func (svr *server) htmlFilter(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		p := r.URL.Path
 		if strings.HasSuffix(p, "/") {
 			p += "index.html"
 		}
-		if path.Ext(p) == ".html" {
-			p = filepath.Join(svr.buildDir, filepath.FromSlash(p[1:])) // Convert URL path to file path.
-			if !fsx.FileExists(p) {
-				http.Error(w, "404: file not found: "+p, 404)
-				return
-
-			}
-			content, err := fsx.ReadFile(p)
-			if err != nil {
-				http.Error(w, "500: "+err.Error(), 500)
-				return
-			}
-			if svr.livereload {
-				// Inject LiveReload script tag.
-				content = strings.Replace(content, "</body>", "<script src=\"http://localhost:"+fmt.Sprintf("%d", svr.lrport)+"/livereload.js\"></script>\n</body>", 1)
-				// Inject navigation plugin.
-				if svr.navigate {
-					content = strings.Replace(content, "</body>", "<script>\n"+navigatePlugin+"\n</script>\n</body>", 1)
-				}
-			}
-			// Strip urlprefix from URLs.
-			if svr.urlprefix() != "" {
-				content = strings.Replace(content, "href=\""+svr.urlprefix(), "href=\"", -1)
-				content = strings.Replace(content, "src=\""+svr.urlprefix(), "src=\"", -1)
-			}
-			w.Header().Set("Content-Type", "text/html; charset=utf-8")
-			w.Write([]byte(content))
-		} else {
+		f := filepath.Join(svr.buildDir, filepath.FromSlash(p[1:])) // Convert URL path to file path.
+		switch {
+		case fsx.FileExists(f) && path.Ext(p) == ".html":
+			svr.serveHTML(w, f, http.StatusOK)
+		case fsx.FileExists(f) || fsx.DirExists(f):
 			h.ServeHTTP(w, r)
+		case svr.notFoundPage() != "" && fsx.FileExists(svr.notFoundPage()):
+			svr.serveHTML(w, svr.notFoundPage(), http.StatusNotFound)
+		default:
+			http.Error(w, "404: file not found: "+f, http.StatusNotFound)
 		}
 	})
 }
 
+// serveHTML writes HTML file f to the response with HTTP status code status.
+func (svr *server) serveHTML(w http.ResponseWriter, f string, status int) {
+	content, err := fsx.ReadFile(f)
+	if err != nil {
+		http.Error(w, "500: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if svr.livereload {
+		// Inject LiveReload script tag.
+		content = strings.Replace(content, "</body>", "<script src=\"http://localhost:"+fmt.Sprintf("%d", svr.lrport)+"/livereload.js\"></script>\n</body>", 1)
+		// Inject navigation plugin.
+		if svr.navigate {
+			content = strings.Replace(content, "</body>", "<script>\n"+navigatePlugin+"\n</script>\n</body>", 1)
+		}
+	}
+	// Strip urlprefix from URLs.
+	if svr.urlprefix() != "" {
+		content = strings.Replace(content, "href=\""+svr.urlprefix(), "href=\"", -1)
+		content = strings.Replace(content, "src=\""+svr.urlprefix(), "src=\"", -1)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write([]byte(content))
+}
+
 // watcherFilter filters and debounces fsnotify events. When there has been a
 // lull in file system events arriving on the in input channel then forward the
 // most recent accepted file system notification event to the output channel.
@@ -233,6 +313,7 @@ func (svr *server) serve() error {
 	if err != nil && err != ErrNonFatal {
 		return err
 	}
+	svr.logSchedule()
 	// Create file system watcher.
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
@@ -284,39 +365,43 @@ func (svr *server) serve() error {
 		handler = svr.saveBrowserURL(handler)
 		handler = svr.logRequest(handler)
 		httpsvr := &http.Server{Addr: ":" + fmt.Sprintf("%d", svr.httpport), Handler: handler}
-		select {
-		case <-svr.quit:
+		go func() {
+			<-svr.quit
 			if err := httpsvr.Shutdown(context.TODO()); err != nil {
 				panic(err) // Failed to shut down the server gracefully.
 			}
-			return
-		default:
-			err := httpsvr.ListenAndServe()
+		}()
+		if err := httpsvr.ListenAndServe(); err != http.ErrServerClosed {
 			svr.close(err)
 		}
 	}()
 	// Start watcher event filter.
 	fsevent := make(chan fsnotify.Event, 2)
 	go svr.watcherFilter(watcher, fsevent)
-	// Start keyboard monitor.
+	// Start keyboard monitor (there are no keyboard commands without a console).
 	kb := make(chan string)
-	go func() {
-		select {
-		case <-svr.quit:
-			return
-		default:
+	if svr.in != nil || !svr.silent {
+		go func() {
 			reader := bufio.NewReader(os.Stdin)
 			for {
 				var line string
 				if svr.in == nil {
 					line, _ = reader.ReadString('\n')
 				} else {
-					line = <-svr.in
+					select {
+					case line = <-svr.in:
+					case <-svr.quit:
+						return
+					}
+				}
+				select {
+				case kb <- line:
+				case <-svr.quit:
+					return
 				}
-				kb <- line
 			}
-		}
-	}()
+		}()
+	}
 	// Launch browser.
 	if svr.launch {
 		go func() {
@@ -326,7 +411,10 @@ func (svr *server) serve() error {
 			}
 		}()
 	}
-	// Monitor and execute build notifications from keyboard and file system.
+	// Monitor and execute build notifications from keyboard, file system and
+	// publication schedule.
+	schedule := time.NewTicker(scheduleInterval)
+	defer schedule.Stop()
 	go func() {
 		for {
 			select {
@@ -353,21 +441,12 @@ func (svr *server) serve() error {
 				}
 			case evt := <-fsevent:
 				start := time.Now()
-				switch evt.Op {
-				case fsnotify.Create, fsnotify.Write:
-					t := fsx.FileModTime(svr.homepage())
-					err = svr.writeFile(evt.Name)
-					if err == nil && t.Before(fsx.FileModTime(svr.homepage())) {
-						// homepage was modified by this event.
-						err = svr.copyHomePage()
-					}
-					svr.logConsole("%s: updated: \"%s\"", start.Format("15:04:05"), evt.Name)
-				case fsnotify.Remove, fsnotify.Rename:
-					err = svr.removeFile(evt.Name)
-					svr.logConsole("%s: removed: \"%s\"", start.Format("15:04:05"), evt.Name)
-				default:
-					panic(fmt.Sprintf("unexpected event: %s: \"%s\"", evt.Op.String(), evt.Name))
+				err = svr.update(evt)
+				action := "updated"
+				if evt.Op == fsnotify.Remove || evt.Op == fsnotify.Rename {
+					action = "removed"
 				}
+				svr.logConsole("%s: %s: \"%s\"", start.Format("15:04:05"), action, evt.Name)
 				if err != nil {
 					svr.logError(err.Error())
 				}
@@ -376,6 +455,19 @@ func (svr *server) serve() error {
 				}
 				svr.logHighlight("time: %.3fs\n", (time.Since(start) + watcherLullTime).Seconds())
 				if svr.livereload {
+					if u := svr.liveCSS(evt); u != "" {
+						lr.Reload(u) // Hot-swap the style sheet.
+					} else {
+						lr.Reload(svr.browserURL)
+					}
+				}
+			case <-schedule.C:
+				svr.resetLogs()
+				changed, err := svr.publishScheduled()
+				if err != nil {
+					svr.logError(err.Error())
+				}
+				if changed && svr.livereload {
 					lr.Reload(svr.browserURL)
 				}
 			case err := <-watcher.Errors:
@@ -387,6 +479,29 @@ func (svr *server) serve() error {
 	return svr.err
 }
 
+// update handles a content or template directory file system event. The
+// error and warning logs are reset so that they only record the latest
+// event's diagnostics.
+func (svr *server) update(evt fsnotify.Event) error {
+	svr.resetLogs()
+	switch evt.Op {
+	case fsnotify.Create, fsnotify.Write:
+		t := fsx.FileModTime(svr.homepage())
+		if err := svr.writeFile(evt.Name); err != nil {
+			return err
+		}
+		if t.Before(fsx.FileModTime(svr.homepage())) {
+			// homepage was modified by this event.
+			return svr.copyHomePage()
+		}
+		return nil
+	case fsnotify.Remove, fsnotify.Rename:
+		return svr.removeFile(evt.Name)
+	default:
+		panic(fmt.Sprintf("unexpected event: %s: \"%s\"", evt.Op.String(), evt.Name))
+	}
+}
+
 // createFile handles the fsnotify Create event and adds the file to the build
 // set.
 func (svr *server) createFile(f string) error {
@@ -399,14 +514,17 @@ func (svr *server) createFile(f string) error {
 		if err != nil {
 			return err
 		}
-		if doc.isDraft() {
-			svr.logVerbose("skip draft: \"%s\"", f)
+		svr.setUpcoming(f, &doc)
+		if reason := doc.skipReason(); reason != "" {
+			svr.logVerbose("skip %s: \"%s\"", reason, f)
 			return nil
 		}
+		relations := svr.relations()
 		if err := svr.docs.add(&doc); err != nil {
 			return err
 		}
 		svr.idxs.addDocument(&doc)
+		svr.docs.setSeries()
 		// Rebuild indexes containing the new document.
 		for _, idx := range svr.idxs {
 			if fsx.PathIsInDir(doc.templatePath, idx.templateDir) {
@@ -416,7 +534,18 @@ func (svr *server) createFile(f string) error {
 			}
 		}
 		svr.setNavigateURL(doc.url)
-		return svr.renderDocument(&doc)
+		if err := svr.renderDocument(&doc); err != nil {
+			return err
+		}
+		if err := svr.renderRelations(relations, &doc); err != nil {
+			return err
+		}
+		if err := svr.buildRedirects(); err != nil {
+			return err
+		}
+		return svr.buildSearchIndexes()
+	case len(svr.assetBundlesOf(f)) > 0:
+		return svr.rebuildAssetBundles(f)
 	case fsx.PathIsInDir(f, svr.contentDir):
 		return svr.buildStaticFile(f)
 	case fsx.PathIsInDir(f, svr.templateDir):
@@ -431,13 +560,18 @@ func (svr *server) createFile(f string) error {
 func (svr *server) removeFile(f string) error {
 	switch {
 	case svr.isDocument(f):
+		if !fsx.FileExists(f) {
+			svr.setUpcoming(f, nil) // Deleted (rather than unpublished) document.
+		}
 		doc := svr.docs.byContentPath[f]
 		if doc == nil {
 			// The document may have been a draft so can't assume this is an error.
 			return nil
 		}
+		relations := svr.relations()
 		// Delete from documents.
 		svr.docs.delete(doc)
+		svr.docs.setSeries()
 		// Rebuild indexes containing the removed document.
 		for _, idx := range svr.idxs {
 			if fsx.PathIsInDir(doc.templatePath, idx.templateDir) {
@@ -448,8 +582,29 @@ func (svr *server) removeFile(f string) error {
 			}
 		}
 		svr.logVerbose("delete document: \"%s\"", doc.buildPath)
-		return os.Remove(doc.buildPath)
+		if err := os.Remove(doc.buildPath); err != nil {
+			return err
+		}
+		if err := svr.removeBuildFiles(append(append([]string{}, doc.aliasPaths...), doc.resourcePaths()...)); err != nil {
+			return err
+		}
+		if err := svr.renderRelations(relations, doc); err != nil {
+			return err
+		}
+		if err := svr.buildRedirects(); err != nil {
+			return err
+		}
+		return svr.buildSearchIndexes()
+	case len(svr.assetBundlesOf(f)) > 0:
+		return svr.rebuildAssetBundles(f)
 	case fsx.PathIsInDir(f, svr.contentDir):
+		if index := svr.bundleIndex(f); index != "" {
+			if doc := svr.docs.byContentPath[index]; doc != nil && fsx.FileExists(doc.resourcePath(f)) {
+				svr.logVerbose("delete resource: \"%s\"", doc.resourcePath(f))
+				return os.Remove(doc.resourcePath(f))
+			}
+			return nil
+		}
 		f := fsx.PathTranslate(f, svr.contentDir, svr.buildDir)
 		// The deleted content may have been a directory.
 		if fsx.FileExists(f) {
@@ -464,6 +619,81 @@ func (svr *server) removeFile(f string) error {
 	}
 }
 
+// rebuildAssetBundles rebuilds the asset bundles that content file f is a
+// source of.
+func (svr *server) rebuildAssetBundles(f string) error {
+	for _, b := range svr.assetBundlesOf(f) {
+		if err := svr.buildAssetBundle(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// liveCSS returns the URL of the style sheet updated by a content directory
+// file create or write event (blank if a style sheet was not updated).
+// LiveReload hot-swaps updated style sheets without reloading the page.
+func (svr *server) liveCSS(evt fsnotify.Event) string {
+	f := evt.Name
+	if (evt.Op != fsnotify.Create && evt.Op != fsnotify.Write) || !fsx.PathIsInDir(f, svr.contentDir) {
+		return ""
+	}
+	for _, b := range svr.assetBundlesOf(f) {
+		if path.Ext(b.name) == ".css" {
+			return "/" + b.name
+		}
+	}
+	if filepath.Ext(f) == ".css" && svr.bundleIndex(f) == "" && !svr.exclude(f) && fsx.FileExists(f) {
+		return rootRelURL(relPath(f, svr.contentDir))
+	}
+	return ""
+}
+
+// removeBuildFiles deletes document alias redirect pages and resources from
+// the build directory.
+func (svr *server) removeBuildFiles(files []string) error {
+	for _, f := range files {
+		if fsx.FileExists(f) {
+			svr.logVerbose("delete: \"%s\"", f)
+			if err := os.Remove(f); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// relations returns a hash of each document's related and series documents.
+// Only the document fields that are rendered in related and series lists are
+// hashed.
+func (svr *server) relations() map[*document]string {
+	result := map[*document]string{}
+	for _, doc := range svr.docs.byContentPath {
+		values := []string{}
+		for _, list := range []documentsList{doc.related, doc.seriesDocs} {
+			for _, d := range list {
+				values = append(values, d.url, d.title, nz(d.author), d.description, d.date.String(), strings.Join(d.tags, "|"))
+			}
+			values = append(values, "") // List separator.
+		}
+		result[doc] = hashOf(values...)
+	}
+	return result
+}
+
+// renderRelations re-renders documents (other than the changed doc) whose
+// related or series documents have changed since the relations were hashed.
+func (svr *server) renderRelations(relations map[*document]string, doc *document) error {
+	for d, h := range svr.relations() {
+		if d != doc && h != relations[d] {
+			if err := svr.renderDocument(d); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // writeFile handles document creation an update events. If the document is
 // changed to a draft it is removed from the build set.
 func (svr *server) writeFile(f string) error {
@@ -473,31 +703,35 @@ func (svr *server) writeFile(f string) error {
 		if err != nil {
 			return err
 		}
+		svr.setUpcoming(f, &newDoc)
 		doc := svr.docs.byContentPath[f]
 		if doc == nil {
-			if newDoc.isDraft() {
-				// Draft document updated, don't do anything.
-				svr.logVerbose("skip draft: \"%s\"", f)
+			if reason := newDoc.skipReason(); reason != "" {
+				// Unpublished document updated, don't do anything.
+				svr.logVerbose("skip %s: \"%s\"", reason, f)
 				return nil
 			}
-			// Document has just been created and written or was a draft and has changed to non-draft.
+			// Document has just been created and written or was unpublished and has changed to published.
 			return svr.createFile(f)
 		}
 		// Arrive here if an existing published document has been updated.
-		if newDoc.isDraft() {
-			// Document changed to draft.
-			svr.logVerbose("skip draft: \"%s\"", f)
+		if reason := newDoc.skipReason(); reason != "" {
+			// Document changed to unpublished.
+			svr.logVerbose("skip %s: \"%s\"", reason, f)
 			return svr.removeFile(f)
 		}
 		oldDoc := *doc
+		relations := svr.relations()
 		if err = svr.docs.update(doc, newDoc); err != nil {
 			return err
 		}
+		svr.docs.setSeries()
 		// Rebuild affected document index pages.
 		for _, idx := range svr.idxs {
 			if fsx.PathIsInDir(doc.templatePath, idx.templateDir) {
-				if oldDoc.date.Equal(doc.date) && strings.Join(oldDoc.tags, ",") == strings.Join(doc.tags, ",") {
-					// Neither date ordering or tags have changed so only rebuild document index pages containing doc.
+				if oldDoc.date.Equal(doc.date) && oldDoc.title == doc.title && oldDoc.weight == doc.weight &&
+					strings.Join(oldDoc.tags, ",") == strings.Join(doc.tags, ",") && reflect.DeepEqual(oldDoc.terms, doc.terms) {
+					// Neither index ordering or taxonomy terms have changed so only rebuild document index pages containing doc.
 					if err := idx.build(doc); err != nil {
 						return err
 					}
@@ -510,7 +744,23 @@ func (svr *server) writeFile(f string) error {
 			}
 		}
 		svr.setNavigateURL(doc.url)
-		return svr.renderDocument(doc)
+		if err := svr.renderDocument(doc); err != nil {
+			return err
+		}
+		if err := svr.renderRelations(relations, doc); err != nil {
+			return err
+		}
+		if err := svr.removeBuildFiles(slice.New(oldDoc.aliasPaths...).Filter(func(f string) bool {
+			return !slice.New(doc.aliasPaths...).Has(f)
+		})); err != nil {
+			return err
+		}
+		if err := svr.buildRedirects(); err != nil {
+			return err
+		}
+		return svr.buildSearchIndexes()
+	case len(svr.assetBundlesOf(f)) > 0:
+		return svr.rebuildAssetBundles(f)
 	case fsx.PathIsInDir(f, svr.contentDir):
 		return svr.buildStaticFile(f)
 	case fsx.PathIsInDir(f, svr.templateDir):
@@ -10,6 +10,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/srackham/hindsite/v2/fsx"
 )
 
@@ -167,3 +168,277 @@ func TestHTTPHandlers(t *testing.T) {
 		t.Errorf("htmlFilter handler: response contains urlprefix: %#v", site.urlprefix())
 	}
 }
+
+func TestNotFoundHandler(t *testing.T) {
+	defer quiet()()
+	tmpdir := initTestSite(t, "hindsite-notfound-tests")
+	fsx.WriteFile(filepath.Join(tmpdir, "content", "404.md"), "---\ntitle: Page Not Found\n---\nNothing here.\n")
+	cmd := "hindsite build -site " + tmpdir + " -var sitemap=true"
+	if _, err := execute(cmd); err != nil {
+		t.Fatalf("%s: %s", cmd, err.Error())
+	}
+	sitemap, _ := fsx.ReadFile(filepath.Join(tmpdir, "build", "sitemap.xml"))
+	if strings.Contains(sitemap, "404.html") {
+		t.Errorf("sitemap contains notfound page")
+	}
+	site := New()
+	if err := site.parseArgs(strings.Split("hindsite nop -site "+tmpdir, " ")); err != nil {
+		t.Fatal(err)
+	}
+	if err := site.parseConfigFiles(); err != nil {
+		t.Fatal(err)
+	}
+	svr := newServer(&site)
+	handler := svr.htmlFilter(http.FileServer(http.Dir(site.buildDir)))
+	for _, u := range []string{"/missing.html", "/missing/", "/missing.png"} {
+		req, err := http.NewRequest("GET", u, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if status := rr.Code; status != http.StatusNotFound {
+			t.Errorf("%s: handler returned wrong status code: got %v want %v", u, status, http.StatusNotFound)
+		}
+		got := rr.Body.String()
+		for _, wanted := range []string{"Nothing here.", "<script src=\"http://localhost:35729/livereload.js\"></script>"} {
+			if !strings.Contains(got, wanted) {
+				t.Errorf("%s: htmlFilter handler: response did not contain: %#v", u, wanted)
+			}
+		}
+	}
+	// Without a notfound page missing files return plain text errors.
+	os.Remove(filepath.Join(tmpdir, "build", "404.html"))
+	req, _ := http.NewRequest("GET", "/missing.html", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotFound || !strings.HasPrefix(rr.Body.String(), "404: file not found: ") {
+		t.Errorf("htmlFilter handler: unexpected response: %v %#v", rr.Code, rr.Body.String())
+	}
+}
+
+func TestAssetBundleRebuild(t *testing.T) {
+	tmpdir := initTestSite(t, "hindsite-bundle-serve-tests")
+	src := filepath.Join(tmpdir, "content", "css", "a.css")
+	fsx.WritePath(src, "p { color: red; }\n")
+	fsx.WriteFile(filepath.Join(tmpdir, "content", "css", "b.css"), "h1 { color: blue; }\n")
+	cmd := "hindsite serve -site " + tmpdir + " -var bundles=bundle.css:css/a.css,css/b.css -var fingerprint=*.css"
+	site := New()
+	site.out = make(chan string, 1000)
+	if err := site.parseArgs(strings.Split(cmd, " ")); err != nil {
+		t.Fatal(err)
+	}
+	svr := newServer(&site)
+	if err := svr.build(); err != nil && err != ErrNonFatal {
+		t.Fatal(err)
+	}
+	bundle := filepath.Join(tmpdir, "build", "bundle.css")
+	if got, _ := fsx.ReadFile(bundle); got != "p { color: red; }\nh1 { color: blue; }\n" {
+		t.Errorf("unexpected bundle (fingerprinting is disabled when serving): %#v", got)
+	}
+	// A changed source rebuilds the bundle and hot-swaps the style sheet.
+	fsx.WriteFile(src, "p { color: green; }\n")
+	if err := svr.writeFile(src); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := fsx.ReadFile(bundle); !strings.HasPrefix(got, "p { color: green; }\n") {
+		t.Errorf("bundle was not rebuilt: %#v", got)
+	}
+	if got := svr.liveCSS(fsnotify.Event{Name: src, Op: fsnotify.Write}); got != "/bundle.css" {
+		t.Errorf("liveCSS: got %#v want %#v", got, "/bundle.css")
+	}
+	if got := svr.liveCSS(fsnotify.Event{Name: filepath.Join(tmpdir, "content", "main.css"), Op: fsnotify.Write}); got != "/main.css" {
+		t.Errorf("liveCSS: got %#v want %#v", got, "/main.css")
+	}
+	if got := svr.liveCSS(fsnotify.Event{Name: filepath.Join(tmpdir, "content", "posts", "document-3.md"), Op: fsnotify.Write}); got != "" {
+		t.Errorf("liveCSS: got %#v want blank", got)
+	}
+}
+
+func TestServeRelated(t *testing.T) {
+	tmpdir := initTestSite(t, "hindsite-serve-related-tests")
+	fsx.WriteFile(filepath.Join(tmpdir, "template", "related.html"),
+		"{{range .related}}{{.title}}|{{end}}")
+	post := func(name, title, tags, date string) string {
+		f := filepath.Join(tmpdir, "content", "posts", name+".md")
+		fsx.WriteFile(f, "---\ntitle: "+title+"\ntags: "+tags+"\ndate: "+date+"\nlayout: related.html\n---\n")
+		return f
+	}
+	post("a", "a", "[xx]", "2020-01-01")
+	b := post("b", "b", "[xx]", "2020-01-02")
+	site := New()
+	site.out = make(chan string, 1000)
+	if err := site.parseArgs(strings.Split("hindsite serve -site "+tmpdir, " ")); err != nil {
+		t.Fatal(err)
+	}
+	svr := newServer(&site)
+	if err := svr.build(); err != nil {
+		t.Fatal(err)
+	}
+	check := func(wanted string) {
+		t.Helper()
+		got, _ := fsx.ReadFile(filepath.Join(tmpdir, "build", "posts", "2020-01-01", "a", "index.html"))
+		if got != wanted {
+			t.Errorf("got %#v want %#v", got, wanted)
+		}
+	}
+	check("b|")
+	// Retitled related document.
+	post("b", "B", "[xx]", "2020-01-02")
+	if err := svr.writeFile(b); err != nil {
+		t.Fatal(err)
+	}
+	check("B|")
+	// New related document.
+	c := post("c", "c", "[xx]", "2020-01-03")
+	if err := svr.createFile(c); err != nil {
+		t.Fatal(err)
+	}
+	check("c|B|")
+	// Unrelated document.
+	post("b", "B", "[yy]", "2020-01-02")
+	if err := svr.writeFile(b); err != nil {
+		t.Fatal(err)
+	}
+	check("c|")
+	// Removed related document.
+	os.Remove(c)
+	if err := svr.removeFile(c); err != nil {
+		t.Fatal(err)
+	}
+	check("")
+}
+
+func TestServeSeries(t *testing.T) {
+	tmpdir := initTestSite(t, "hindsite-serve-series-tests")
+	fsx.WriteFile(filepath.Join(tmpdir, "template", "series.html"),
+		"{{with .series}}{{range .docs}}{{.title}}|{{end}}{{end}}")
+	post := func(name, title, part, date string) string {
+		f := filepath.Join(tmpdir, "content", "posts", name+".md")
+		fsx.WriteFile(f, "---\ntitle: "+title+"\nseries: S\nseries_part: "+part+"\ndate: "+date+"\nlayout: series.html\n---\n")
+		return f
+	}
+	post("a", "a", "1", "2020-01-01")
+	b := post("b", "b", "2", "2020-01-02")
+	site := New()
+	site.out = make(chan string, 1000)
+	if err := site.parseArgs(strings.Split("hindsite serve -site "+tmpdir, " ")); err != nil {
+		t.Fatal(err)
+	}
+	svr := newServer(&site)
+	if err := svr.build(); err != nil {
+		t.Fatal(err)
+	}
+	check := func(wanted string) {
+		t.Helper()
+		got, _ := fsx.ReadFile(filepath.Join(tmpdir, "build", "posts", "2020-01-01", "a", "index.html"))
+		if got != wanted {
+			t.Errorf("got %#v want %#v", got, wanted)
+		}
+	}
+	check("a|b|")
+	// Retitled series document.
+	post("b", "B", "2", "2020-01-02")
+	if err := svr.writeFile(b); err != nil {
+		t.Fatal(err)
+	}
+	check("a|B|")
+	// Reordered series.
+	post("b", "B", "1", "2019-12-31")
+	if err := svr.writeFile(b); err != nil {
+		t.Fatal(err)
+	}
+	check("B|a|")
+	// New series document.
+	c := post("c", "c", "3", "2020-01-03")
+	if err := svr.createFile(c); err != nil {
+		t.Fatal(err)
+	}
+	check("B|a|c|")
+	// Removed series document.
+	os.Remove(b)
+	if err := svr.removeFile(b); err != nil {
+		t.Fatal(err)
+	}
+	check("a|c|")
+}
+
+func TestServeLogs(t *testing.T) {
+	tmpdir := initTestSite(t, "hindsite-serve-logs-tests")
+	site := New()
+	site.out = make(chan string, 1000)
+	if err := site.parseArgs(strings.Split("hindsite serve -site "+tmpdir, " ")); err != nil {
+		t.Fatal(err)
+	}
+	svr := newServer(&site)
+	if err := svr.build(); err != nil {
+		t.Fatal(err)
+	}
+	if svr.warnings == 0 || len(svr.warningLog) != svr.warnings {
+		t.Fatalf("unexpected build warnings: %d: %v", svr.warnings, svr.warningLog)
+	}
+	// Each serve event resets the error and warning logs.
+	f := filepath.Join(tmpdir, "content", "posts", "logs.md")
+	for i := 0; i < 3; i++ {
+		fsx.WriteFile(f, "---\ndate: foobar\n---\n")
+		err := svr.update(fsnotify.Event{Name: f, Op: fsnotify.Write})
+		if err == nil {
+			t.Fatal("expected front matter error")
+		}
+		svr.logError(err.Error())
+		if svr.warnings != 0 || len(svr.warningLog) != 0 || svr.errors != 1 || len(svr.errorLog) != 1 {
+			t.Errorf("event %d: warnings: %d: %v: errors: %d: %v", i, svr.warnings, svr.warningLog, svr.errors, svr.errorLog)
+		}
+	}
+}
+
+func TestServeSchedule(t *testing.T) {
+	tmpdir := initTestSite(t, "hindsite-serve-schedule-tests")
+	site := New()
+	site.out = make(chan string, 1000)
+	if err := site.parseArgs(strings.Split("hindsite serve -site "+tmpdir, " ")); err != nil {
+		t.Fatal(err)
+	}
+	svr := newServer(&site)
+	if err := svr.build(); err != nil && err != ErrNonFatal {
+		t.Fatal(err)
+	}
+	f := filepath.Join(tmpdir, "content", "scheduled.md")
+	buildFile := filepath.Join(tmpdir, "build", "scheduled.html")
+	write := func(date time.Time) {
+		t.Helper()
+		fsx.WriteFile(f, "---\ndate: "+date.Format("2006-01-02 15:04:05-07:00")+"\n---\n")
+		if err := svr.writeFile(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A published document that becomes future dated is unpublished and scheduled.
+	write(time.Now().Add(-time.Hour))
+	if !fsx.FileExists(buildFile) {
+		t.Fatalf("missing published document: %s", buildFile)
+	}
+	write(time.Now().Add(2 * time.Second))
+	if fsx.FileExists(buildFile) || len(svr.upcoming) != 1 || svr.upcoming[0].contentPath != f {
+		t.Fatalf("document not scheduled: %v", svr.upcoming)
+	}
+	if changed, err := svr.publishScheduled(); err != nil || changed {
+		t.Fatalf("unexpected publication: %v", err)
+	}
+	// The document is published when its date arrives.
+	time.Sleep(time.Until(svr.upcoming[0].date))
+	if changed, err := svr.publishScheduled(); err != nil || !changed {
+		t.Fatalf("document not published: %v", err)
+	}
+	if !fsx.FileExists(buildFile) || len(svr.upcoming) != 0 {
+		t.Fatalf("document not published: %v", svr.upcoming)
+	}
+	// Removed upcoming documents are unscheduled.
+	write(time.Now().Add(time.Hour))
+	os.Remove(f)
+	if err := svr.removeFile(f); err != nil {
+		t.Fatal(err)
+	}
+	if len(svr.upcoming) != 0 {
+		t.Errorf("removed document is scheduled: %v", svr.upcoming)
+	}
+}
@@ -1,13 +1,18 @@
 package site
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"path"
 	"path/filepath"
+	"runtime"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/srackham/hindsite/v2/fsx"
@@ -34,9 +39,19 @@ type site struct {
 	out           chan string
 	confs         []config
 	docs          documentsLookup
+	upcoming      documentsList // Future dated documents excluded from the build.
 	idxs          indexes
 	htmlTemplates htmlTemplates
 	textTemplates textTemplates
+	cache         buildCache           // Incremental build cache.
+	fingerprints  map[string]string    // Fingerprinted static file URLs keyed by original URL.
+	images        map[string]imageInfo // Image derivatives keyed by static image file path.
+	imagesMutex   *sync.Mutex          // Guards images (documents are rendered concurrently).
+	logMutex      *sync.Mutex          // Serializes console output and the error and warning logs.
+	data          templateData         // Template data directory files.
+	contentFS     fs.FS                // Content directory file system (OS file system if nil).
+	templateFS    fs.FS                // Template directory file system (OS file system if nil).
+	buildFS       fsx.Output           // Build directory output.
 	// Command options
 	siteDir     string
 	contentDir  string
@@ -44,8 +59,10 @@ type site struct {
 	buildDir    string
 	indexDir    string
 	initDir     string
+	dataDir     string
 	from        string
 	drafts      bool
+	future      bool
 	lint        bool
 	launch      bool
 	httpport    uint16
@@ -53,18 +70,30 @@ type site struct {
 	livereload  bool
 	navigate    bool
 	keep        bool
+	incremental bool
+	jobs        int
 	verbosity   int
 	vars        rawConfig
 	errors      int //Non fatal error count.
 	warnings    int //Warnings count.
+	// API options
+	ctx        context.Context // Cancels builds (nil if not cancelable).
+	silent     bool            // Do not print console output.
+	log        io.Writer       // Silent mode console output (nil discards output).
+	errorLog   []Diagnostic    // Build errors.
+	warningLog []Diagnostic    // Build warnings.
 }
 
 // New creates a new site.
 func New() site {
 	return site{
-		httpport:   1212,
-		lrport:     35729,
-		livereload: true,
+		httpport:    1212,
+		lrport:      35729,
+		livereload:  true,
+		jobs:        runtime.NumCPU(),
+		buildFS:     fsx.DiskOutput{},
+		imagesMutex: &sync.Mutex{},
+		logMutex:    &sync.Mutex{},
 	}
 }
 
@@ -74,17 +103,14 @@ func (site *site) Execute(args []string) error {
 	err = site.parseArgs(args)
 	if err == nil {
 		switch site.command {
-		case "build":
-			err = site.build()
+		case "build", "serve":
+			err = site.run()
 		case "help":
 			err = site.help()
 		case "init":
 			err = site.init()
 		case "new":
 			err = site.new()
-		case "serve":
-			svr := newServer(site)
-			err = svr.serve()
 		case "nop":
 			// Do nothing, used by tests
 		default:
@@ -97,6 +123,51 @@ func (site *site) Execute(args []string) error {
 	return err
 }
 
+// run executes the build and serve commands with the public API.
+func (site *site) run() error {
+	if len(site.cmdargs) > 0 {
+		return fmt.Errorf("to many command arguments")
+	}
+	s, err := Open(Options{
+		SiteDir:     site.siteDir,
+		ContentDir:  site.contentDir,
+		TemplateDir: site.templateDir,
+		BuildDir:    site.buildDir,
+		Drafts:      site.drafts,
+		Future:      site.future,
+		Lint:        site.lint,
+		Keep:        site.keep,
+		Incremental: site.incremental,
+		Jobs:        site.jobs,
+		HTTPPort:    site.httpport,
+		LRPort:      site.lrport,
+		NoReload:    !site.livereload,
+		Navigate:    site.navigate,
+		Launch:      site.launch,
+		Console:     true,
+	})
+	if err != nil {
+		return err
+	}
+	// The -var and -config options have already been parsed (in command-line
+	// order) and the directories logged by parseArgs.
+	s.site.vars = site.vars
+	s.site.verbosity = site.verbosity
+	s.site.out = site.out
+	s.site.in = site.in
+	if site.command == "serve" {
+		return s.Serve(context.Background())
+	}
+	result, err := s.Build(context.Background())
+	if err != nil {
+		return err
+	}
+	if len(result.Errors) > 0 {
+		return ErrNonFatal
+	}
+	return nil
+}
+
 // parseArgs parses and validates hindsite command-line arguments.
 func (site *site) parseArgs(args []string) error {
 	skip := false
@@ -121,6 +192,8 @@ func (site *site) parseArgs(args []string) error {
 			site.command = opt
 		case opt == "-drafts":
 			site.drafts = true
+		case opt == "-future":
+			site.future = true
 		case opt == "-lint":
 			site.lint = true
 		case opt == "-launch":
@@ -129,11 +202,13 @@ func (site *site) parseArgs(args []string) error {
 			site.navigate = true
 		case opt == "-keep":
 			site.keep = true
+		case opt == "-incremental":
+			site.incremental = true
 		case opt == "-v":
 			site.verbosity++
 		case opt == "-vv":
 			site.verbosity += 2
-		case slice.New("-site", "-content", "-template", "-build", "-from", "-port", "-var", "-config").Has(opt):
+		case slice.New("-site", "-content", "-template", "-build", "-from", "-port", "-jobs", "-var", "-config").Has(opt):
 			// Process option argument.
 			if i+1 >= len(args) {
 				return fmt.Errorf("missing %s argument value", opt)
@@ -170,6 +245,12 @@ func (site *site) parseArgs(args []string) error {
 						site.lrport = uint16(i)
 					}
 				}
+			case "-jobs":
+				i, err := strconv.ParseUint(arg, 10, 16)
+				if err != nil || i == 0 {
+					return fmt.Errorf("illegal -jobs: \"%s\"", arg)
+				}
+				site.jobs = int(i)
 			case "-var":
 				if err := site.vars.parseVar(arg); err != nil {
 					return err
@@ -191,7 +272,12 @@ func (site *site) parseArgs(args []string) error {
 	if site.command == "help" {
 		return nil
 	}
-	// Validate site, content, template and build directories.
+	return site.setDirs()
+}
+
+// setDirs validates site, content, template and build directories and assigns
+// the hardwired directories.
+func (site *site) setDirs() error {
 	getPath := func(path, defaultPath string) (string, error) {
 		if path == "" {
 			path = defaultPath
@@ -211,7 +297,7 @@ func (site *site) parseArgs(args []string) error {
 		return err
 	}
 	site.logVerbose2("content directory: \"%s\"", site.contentDir)
-	if site.command != "init" && !fsx.DirExists(site.contentDir) {
+	if site.command != "init" && !site.vfs(site.contentDir).DirExists(site.contentDir) {
 		return fmt.Errorf("missing content directory: \"%s\"", site.contentDir)
 	}
 	site.templateDir, err = getPath(site.templateDir, filepath.Join(site.siteDir, "template"))
@@ -219,7 +305,7 @@ func (site *site) parseArgs(args []string) error {
 		return err
 	}
 	site.logVerbose2("template directory: \"%s\"", site.templateDir)
-	if site.command != "init" && !fsx.DirExists(site.templateDir) {
+	if site.command != "init" && !site.vfs(site.templateDir).DirExists(site.templateDir) {
 		return fmt.Errorf("missing template directory: \"%s\"", site.templateDir)
 	}
 	site.buildDir, err = getPath(site.buildDir, filepath.Join(site.siteDir, "build"))
@@ -227,9 +313,10 @@ func (site *site) parseArgs(args []string) error {
 		return err
 	}
 	site.logVerbose2("build directory: \"%s\"", site.buildDir)
-	// init and indexes directories are hardwired.
+	// init, data and indexes directories are hardwired.
 	site.indexDir = filepath.Join(site.buildDir, "indexes")
 	site.initDir = filepath.Join(site.templateDir, "init")
+	site.dataDir = filepath.Join(site.templateDir, "data")
 	// Content, template and build directories cannot be nested.
 	checkOverlap := func(name1, dir1, name2, dir2 string) error {
 		if dir1 == dir2 {
@@ -293,11 +380,14 @@ Options:
     -var      NAME=VALUE
     -port     [HTTP_PORT][:LR_PORT]
     -from     SOURCE
+    -jobs     N
     -drafts
+    -future
     -lint
     -launch
     -navigate
     -keep
+    -incremental
     -v
 
 Version:    ` + VERS + " (" + OS + ")" + `
@@ -336,11 +426,26 @@ func (site *site) homepage() string {
 	return site.confs[0].homepage
 }
 
+// notFoundPage returns the build path of the page served for missing files
+// (blank if the root configuration `notfound` variable is blank).
+func (site *site) notFoundPage() string {
+	if site.confs[0].notfound == "" {
+		return ""
+	}
+	return filepath.Join(site.buildDir, filepath.FromSlash(site.confs[0].notfound))
+}
+
 // urlprefix returns the site-wide root configuration `urlprefix` variable.
 func (site *site) urlprefix() string {
 	return site.confs[0].urlprefix
 }
 
+// absURL returns root-relative URL `u` prefixed with the `urlprefix`. The
+// result is only an absolute URL if the `urlprefix` is absolute.
+func (site *site) absURL(u string) string {
+	return site.urlprefix() + u
+}
+
 // match returns true if content file `f` matches one of the `patterns`.
 // A blank pattern matches nothing.
 // NOTE: Used for matching configuration `exclude`, `include`, `templates`
@@ -398,11 +503,11 @@ func (site *site) configFor(p string) config {
 		panic("path outside content directory: " + p)
 	}
 	dir := fsx.PathTranslate(p, site.contentDir, site.templateDir)
-	if fsx.FileExists(p) {
+	if site.vfs(p).FileExists(p) {
 		dir = filepath.Dir(dir)
 	}
 	result := site.confs[0]
-	result.user = copyMap(site.confs[0].user)
+	result.user = deepCopyMap(site.confs[0].user)
 	for _, conf := range site.confs[1:] {
 		if fsx.PathIsInDir(dir, conf.origin) {
 			result.merge(conf)
@@ -411,6 +516,17 @@ func (site *site) configFor(p string) config {
 	return result
 }
 
+// vfs returns the file system that file path p is read from.
+func (site *site) vfs(p string) fsx.DirFS {
+	switch {
+	case site.contentFS != nil && fsx.PathIsInDir(p, site.contentDir):
+		return fsx.DirFS{Root: site.contentDir, FS: site.contentFS}
+	case site.templateFS != nil && fsx.PathIsInDir(p, site.templateDir):
+		return fsx.DirFS{Root: site.templateDir, FS: site.templateFS}
+	}
+	return fsx.DirFS{}
+}
+
 // parseConfigFiles parses all configuration files from the site template
 // directory to `site.confs`. The root configuration (site.confs[0]) is
 // synthesised by merging configuration defaults with the root configuration
@@ -419,22 +535,29 @@ func (site *site) parseConfigFiles() error {
 	site.confs = []config{}
 	// Assign default root config.
 	site.confs = append(site.confs, config{
-		exclude:    []string{".*"},
-		id:         "optional",
-		paginate:   5,
-		shortdate:  "2006-01-02",
-		mediumdate: "2-Jan-2006",
-		longdate:   "Mon Jan 2, 2006",
-		user:       map[string]string{},
+		exclude:     []string{".*"},
+		id:          "optional",
+		paginate:    5,
+		feedsize:    10,
+		related:     5,
+		sort:        "date-desc",
+		notfound:    "404.html",
+		jpegquality: 85,
+		toclevels:   [2]int{2, 3},
+		shortdate:   "2006-01-02",
+		mediumdate:  "2-Jan-2006",
+		longdate:    "Mon Jan 2, 2006",
+		user:        map[string]interface{}{},
 	})
 	site.confs[0].timezone, _ = time.LoadLocation("Local")
 	site.confs[0].origin = site.templateDir
 	// Parse all config files.
-	err := filepath.Walk(site.templateDir, func(f string, info os.FileInfo, err error) error {
+	vfs := site.vfs(site.templateDir)
+	err := vfs.Walk(site.templateDir, func(f string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
-		if info.IsDir() && f == site.initDir {
+		if info.IsDir() && (f == site.initDir || f == site.dataDir) {
 			return filepath.SkipDir
 		}
 		if !info.IsDir() {
@@ -450,11 +573,15 @@ func (site *site) parseConfigFiles() error {
 		}
 		for _, v := range []string{"config.toml", "config.yaml"} {
 			cf := filepath.Join(f, v)
-			if fsx.FileExists(cf) {
+			if vfs.FileExists(cf) {
 				found = true
 				site.logVerbose("read config: \"%s\"", cf)
 				raw := rawConfig{}
-				if err := raw.parseConfigFile(cf); err != nil {
+				text, err := vfs.ReadFile(cf)
+				if err == nil {
+					err = raw.parseConfig(cf, []byte(text))
+				}
+				if err != nil {
 					return fmt.Errorf("config file: \"%s\": %s", cf, err.Error())
 				}
 				if err := conf.mergeRaw(raw); err != nil {
@@ -468,6 +595,30 @@ func (site *site) parseConfigFiles() error {
 					if conf.urlprefix != "" {
 						site.logWarning(msg, "urlprefix", cf)
 					}
+					if conf.notfound != "" {
+						site.logWarning(msg, "notfound", cf)
+					}
+					if conf.sitemap {
+						site.logWarning(msg, "sitemap", cf)
+					}
+					if conf.minify {
+						site.logWarning(msg, "minify", cf)
+					}
+					if conf.fingerprint != nil {
+						site.logWarning(msg, "fingerprint", cf)
+					}
+					if conf.bundles != nil {
+						site.logWarning(msg, "bundles", cf)
+					}
+					if conf.highlight != "" {
+						site.logWarning(msg, "highlight", cf)
+					}
+					if conf.search != nil {
+						site.logWarning(msg, "search", cf)
+					}
+					if conf.redirects != "" {
+						site.logWarning(msg, "redirects", cf)
+					}
 					if conf.exclude != nil {
 						site.logWarning(msg, "exclude", cf)
 					}
@@ -501,6 +652,15 @@ func (site *site) parseConfigFiles() error {
 		return fmt.Errorf("config variable: %s", err.Error())
 	}
 	site.logVerbose2("root config: \n" + site.confs[0].String())
+	if site.confs[0].sitemap && !strings.HasPrefix(site.urlprefix(), "http") {
+		site.logWarning("sitemap requires an absolute urlprefix: \"%s\"", site.urlprefix())
+	}
+	for _, conf := range site.confs {
+		if len(conf.feeds) > 0 && !strings.HasPrefix(site.urlprefix(), "http") {
+			site.logWarning("feeds require an absolute urlprefix: \"%s\"", site.urlprefix())
+			break
+		}
+	}
 	// Sanity checks.
 	if site.confs[0].origin != site.templateDir {
 		panic("site.conf[0].origin != site.templateDir")
@@ -1,8 +1,13 @@
 package site
 
 import (
+	"bytes"
 	"crypto/sha256"
+	"encoding/json"
 	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
 	"os"
 	"path/filepath"
 	"strings"
@@ -11,6 +16,7 @@ import (
 
 	"github.com/srackham/hindsite/v2/assert"
 	"github.com/srackham/hindsite/v2/fsx"
+	"github.com/srackham/hindsite/v2/slice"
 )
 
 func TestParseArgs(t *testing.T) {
@@ -28,6 +34,7 @@ func TestParseArgs(t *testing.T) {
 	assert.Equal(t, uint16(1212), site.httpport)
 	assert.Equal(t, uint16(35729), site.lrport)
 	assert.Equal(t, false, site.drafts)
+	assert.Equal(t, false, site.future)
 	assert.Equal(t, true, site.livereload)
 	assert.Equal(t, false, site.navigate)
 
@@ -41,9 +48,10 @@ func TestParseArgs(t *testing.T) {
 	assert.Equal(t, uint16(8000), site.lrport)
 	assert.Equal(t, true, site.drafts)
 
-	parse("hindsite serve -port :-1 -drafts -navigate -site ./testdata/blog -content ./testdata/blog/template/init")
+	parse("hindsite serve -port :-1 -drafts -future -navigate -site ./testdata/blog -content ./testdata/blog/template/init")
 	assert.True(t, err == nil)
 	assert.Equal(t, true, site.drafts)
+	assert.Equal(t, true, site.future)
 	assert.Equal(t, false, site.livereload)
 	assert.Equal(t, true, site.navigate)
 
@@ -68,6 +76,13 @@ func TestParseArgs(t *testing.T) {
 	parse("hindsite serve -site ./testdata/blog -port :99999999")
 	assert.Equal(t, `illegal -port: ":99999999"`, err.Error())
 
+	parse("hindsite build -site ./testdata/blog -content ./testdata/blog/template/init -jobs 4")
+	assert.True(t, err == nil)
+	assert.Equal(t, 4, site.jobs)
+
+	parse("hindsite build -site ./testdata/blog -jobs 0")
+	assert.Equal(t, `illegal -jobs: "0"`, err.Error())
+
 	// -var option checks.
 	parse("hindsite build -site ./testdata/blog -var foobar")
 	assert.Equal(t, `illegal -var syntax: "foobar"`, err.Error())
@@ -121,7 +136,14 @@ func TestParseArgs(t *testing.T) {
 	assert.Equal(t, "https://foobar", *site.vars.URLPrefix)
 
 	parse("hindsite build -site ./testdata/blog -var user.foo=bar")
-	assert.Equal(t, "bar", site.vars.User["foo"])
+	assert.Equal(t, "bar", site.vars.User["foo"].(string))
+
+	parse("hindsite build -site ./testdata/blog -var user.social.twitter=@foo -var user.social.github=foo")
+	assert.Equal(t, "@foo", site.vars.User["social"].(map[string]interface{})["twitter"].(string))
+	assert.Equal(t, "foo", site.vars.User["social"].(map[string]interface{})["github"].(string))
+
+	parse("hindsite build -site ./testdata/blog -var user.social.=foo")
+	assert.Equal(t, `illegal -var name: "user.social."`, err.Error())
 
 	// Configuration variable checks.
 	// TODO refactor to TestMergeRaw() and add test cases
@@ -134,14 +156,14 @@ func TestParseArgs(t *testing.T) {
 	parse("hindsite build -site ./testdata/blog -content ./testdata/blog/template/init -var user.foo=bar -config ./testdata/blog/template/config2.toml")
 	assert.True(t, err == nil)
 	assert.Equal(t, "Bill Blow", *site.vars.Author)
-	assert.Equal(t, "qux", site.vars.User["baz"])
-	assert.Equal(t, "qux2", site.vars.User["foo"])
+	assert.Equal(t, "qux", site.vars.User["baz"].(string))
+	assert.Equal(t, "qux2", site.vars.User["foo"].(string))
 
 	parse("hindsite build -site ./testdata/blog -content ./testdata/blog/template/init -config ./testdata/blog/template/config2.toml -config ./testdata/blog/template/config2.yaml")
 	assert.True(t, err == nil)
 	assert.Equal(t, "Bill Blow", *site.vars.Author)
-	assert.Equal(t, "qux", site.vars.User["baz"])
-	assert.Equal(t, "qux3", site.vars.User["foo"])
+	assert.Equal(t, "qux", site.vars.User["baz"].(string))
+	assert.Equal(t, "qux3", site.vars.User["foo"].(string))
 }
 
 func TestExecuteArgs(t *testing.T) {
@@ -211,9 +233,9 @@ func TestExecuteArgs(t *testing.T) {
 
 	// Test built-in templates.
 	buildSiteFrom("hello", "documents: 1\nstatic: 0", 2, 1, 1)
-	buildSiteFrom("blog", "documents: 12\nstatic: 6", 6, 7, 9)
+	buildSiteFrom("blog", "documents: 12\nstatic: 6", 6, 7, 10)
 	assert.PassIf(t, fsx.DirCount(filepath.Join(tmpdir, "content", "posts")) == 7, "unexpected number of files in content/posts directory")
-	buildSiteFrom("docs", "documents: 4\nstatic: 3", 4, 7, 7)
+	buildSiteFrom("docs", "documents: 5\nstatic: 3", 4, 8, 9)
 
 	/*
 		Initialise and build the testdata site for subsequent tests.
@@ -383,3 +405,848 @@ func TestExecuteArgs(t *testing.T) {
 .urlprefix=http://example.com
 .user=map[banner:hindsite | blog highlightjs:yes]`)
 }
+
+// initTestSite initializes the test blog in temporary directory dir and
+// returns the site directory path. dir must be unique to the calling test.
+func initTestSite(t *testing.T, dir string) string {
+	tmpdir := filepath.Join(os.TempDir(), dir)
+	os.RemoveAll(tmpdir)
+	fsx.MkMissingDir(tmpdir)
+	if _, err := execute("hindsite init -site " + tmpdir + " -from ./testdata/blog/template"); err != nil {
+		t.Fatal(err)
+	}
+	return tmpdir
+}
+
+// execute runs hindsite command cmd and returns the command output.
+func execute(cmd string) (out string, err error) {
+	site := New()
+	site.out = make(chan string, 1000)
+	err = site.Execute(strings.Split(cmd, " "))
+	close(site.out)
+	for line := range site.out {
+		out += line + "\n"
+	}
+	out = strings.Replace(out, `\`, `/`, -1) // Normalize MS Windows path separators.
+	return
+}
+
+func TestIncrementalBuild(t *testing.T) {
+	tmpdir := initTestSite(t, "hindsite-incremental-tests")
+	build := "hindsite build -site " + tmpdir + " -incremental -v"
+
+	out, err := execute(build)
+	assert.True(t, err == nil)
+	assert.True(t, fsx.FileExists(filepath.Join(tmpdir, "build", cacheFile)))
+	assert.Contains(t, out, "documents: 11\nstatic: 7")
+	assert.Equal(t, 10, strings.Count(out, "write document:"))
+
+	// Nothing is rendered if nothing has changed.
+	out, err = execute(build)
+	assert.True(t, err == nil)
+	assert.Equal(t, 0, strings.Count(out, "write document:"))
+	assert.Equal(t, 0, strings.Count(out, "build index:"))
+	assert.Equal(t, 0, strings.Count(out, "copy static:"))
+
+	// Only the changed document and its indexes are rendered.
+	f := filepath.Join(tmpdir, "content", "posts", "document-3.md")
+	text, _ := fsx.ReadFile(f)
+	fsx.WriteFile(f, text+"\nAn updated paragraph.\n")
+	out, err = execute(build)
+	assert.True(t, err == nil)
+	assert.Equal(t, 1, strings.Count(out, "write document:"))
+	assert.ContainsPattern(t, out, `write document: ".*/build/posts/2016-10-18/sed-sed/index.html"`)
+	assert.ContainsPattern(t, out, `build index: ".*/build/indexes/posts"`)
+	assert.False(t, strings.Contains(out, "indexes/newsletters"))
+
+	// Outputs of deleted documents are removed.
+	os.Remove(filepath.Join(tmpdir, "content", "newsletters", "2016-09-21-newsletter.md"))
+	out, err = execute(build)
+	assert.True(t, err == nil)
+	assert.ContainsPattern(t, out, `delete stale: ".*/build/newsletters/natoque-pulvinar-vel-porttitor-cras.html"`)
+	assert.False(t, fsx.FileExists(filepath.Join(tmpdir, "build", "newsletters", "natoque-pulvinar-vel-porttitor-cras.html")))
+	assert.ContainsPattern(t, out, `build index: ".*/build/indexes/newsletters"`)
+
+	// Template changes force a full rebuild.
+	f = filepath.Join(tmpdir, "template", "partials.html")
+	text, _ = fsx.ReadFile(f)
+	fsx.WriteFile(f, text+"\n")
+	out, err = execute(build)
+	assert.True(t, err == nil)
+	assert.Contains(t, out, "site configuration or templates changed: full rebuild")
+	assert.Equal(t, 9, strings.Count(out, "write document:"))
+}
+
+func TestFeeds(t *testing.T) {
+	tmpdir := initTestSite(t, "hindsite-feeds-tests")
+	_, err := execute("hindsite build -site " + tmpdir + " -var feeds=atom|rss -var feedsize=2")
+	assert.True(t, err == nil)
+
+	atom, err := fsx.ReadFile(filepath.Join(tmpdir, "build", "indexes", "posts", "feed.atom"))
+	assert.True(t, err == nil)
+	assert.Contains(t, atom, `<feed xmlns="http://www.w3.org/2005/Atom">`)
+	assert.Contains(t, atom, `<link rel="self" href="http://example.com/indexes/posts/feed.atom"/>`)
+	assert.Equal(t, 2, strings.Count(atom, "<entry>"))
+	assert.Contains(t, atom, "<author><name>Joe Bloggs</name></author>")
+	rss, err := fsx.ReadFile(filepath.Join(tmpdir, "build", "indexes", "posts", "feed.rss"))
+	assert.True(t, err == nil)
+	assert.Equal(t, 2, strings.Count(rss, "<item>"))
+	assert.ContainsPattern(t, rss, `<link>http://example.com/posts/.+</link>`)
+	assert.Contains(t, rss, `xmlns:dc="http://purl.org/dc/elements/1.1/"`)
+	assert.Contains(t, rss, "<dc:creator>Joe Bloggs</dc:creator>")
+	assert.False(t, strings.Contains(rss, "<author>"))
+	files, _ := filepath.Glob(filepath.Join(tmpdir, "build", "indexes", "posts", "tags", "*.atom"))
+	assert.True(t, len(files) > 0)
+	assert.True(t, fsx.FileExists(filepath.Join(tmpdir, "build", "indexes", "newsletters", "feed.rss")))
+
+	// Feed templates can be overridden.
+	fsx.WriteFile(filepath.Join(tmpdir, "template", "posts", "feed.xml"), "{{.format}}: {{len .docs}}")
+	_, err = execute("hindsite build -site " + tmpdir + " -var feeds=atom -var feedsize=3")
+	assert.True(t, err == nil)
+	atom, _ = fsx.ReadFile(filepath.Join(tmpdir, "build", "indexes", "posts", "feed.atom"))
+	assert.Equal(t, "atom: 3", atom)
+	assert.False(t, fsx.FileExists(filepath.Join(tmpdir, "build", "indexes", "posts", "feed.rss")))
+}
+
+func TestSitemap(t *testing.T) {
+	tmpdir := initTestSite(t, "hindsite-sitemap-tests")
+	f := filepath.Join(tmpdir, "content", "posts", "document-3.md")
+	text, _ := fsx.ReadFile(f)
+	fsx.WriteFile(f, strings.Replace(text, "---\n", "---\nsitemap: false\n", 1))
+	_, err := execute("hindsite build -site " + tmpdir + " -var sitemap=true")
+	assert.True(t, err == nil)
+
+	sitemap, err := fsx.ReadFile(filepath.Join(tmpdir, "build", "sitemap.xml"))
+	assert.True(t, err == nil)
+	assert.Contains(t, sitemap, `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`)
+	assert.Contains(t, sitemap, "<loc>http://example.com/</loc>")
+	assert.Contains(t, sitemap, "<loc>http://example.com/posts/2016-12-16/document-2/</loc>")
+	assert.False(t, strings.Contains(sitemap, "sed-sed"))
+	assert.ContainsPattern(t, sitemap, `<lastmod>\d{4}-\d\d-\d\dT.+</lastmod>`)
+	robots, err := fsx.ReadFile(filepath.Join(tmpdir, "build", "robots.txt"))
+	assert.True(t, err == nil)
+	assert.Contains(t, robots, "Sitemap: http://example.com/sitemap.xml")
+
+	// An explicit robots.txt is not overwritten.
+	fsx.WriteFile(filepath.Join(tmpdir, "content", "robots.txt"), "User-agent: *\n")
+	out, err := execute("hindsite build -site " + tmpdir + " -var sitemap=true -var urlprefix=/blog")
+	assert.True(t, err == nil)
+	robots, _ = fsx.ReadFile(filepath.Join(tmpdir, "build", "robots.txt"))
+	assert.Equal(t, "User-agent: *\n", robots)
+	assert.Contains(t, out, `sitemap requires an absolute urlprefix: "/blog"`)
+}
+
+func TestMinify(t *testing.T) {
+	tmpdir := initTestSite(t, "hindsite-minify-tests")
+	fsx.WriteFile(filepath.Join(tmpdir, "content", "data.json"), "{\n  \"a\": [1, 2]\n}\n")
+	fsx.WriteFile(filepath.Join(tmpdir, "content", "broken.css"), "p { color: red; } /* Unterminated")
+	out, err := execute("hindsite build -site " + tmpdir + " -var minify=true")
+	assert.True(t, err == nil)
+
+	html, _ := fsx.ReadFile(filepath.Join(tmpdir, "build", "posts", "2016-12-16", "document-2", "index.html"))
+	assert.False(t, strings.Contains(html, "\n  <"))
+	html, _ = fsx.ReadFile(filepath.Join(tmpdir, "build", "indexes", "posts", "docs-1.html"))
+	assert.False(t, strings.Contains(html, "\n  <"))
+	css, _ := fsx.ReadFile(filepath.Join(tmpdir, "build", "main.css"))
+	assert.Contains(t, css, ":root{--primary-color:#527bbd;")
+	json, _ := fsx.ReadFile(filepath.Join(tmpdir, "build", "data.json"))
+	assert.Equal(t, `{"a":[1,2]}`, json)
+	css, _ = fsx.ReadFile(filepath.Join(tmpdir, "build", "broken.css"))
+	assert.Equal(t, "p { color: red; } /* Unterminated", css)
+	assert.Contains(t, out, "minify: \""+filepath.ToSlash(filepath.Join(tmpdir, "build", "broken.css"))+"\": unterminated comment")
+}
+
+func TestFingerprint(t *testing.T) {
+	tmpdir := initTestSite(t, "hindsite-fingerprint-tests")
+	fsx.WriteFile(filepath.Join(tmpdir, "content", "fingerprint.md"), "---\ntemplates: \"*\"\n---\n<div title=\"{{fingerprint \"/main.css\"}}\"></div>\n")
+	build := func() map[string]string {
+		_, err := execute("hindsite build -site " + tmpdir + " -incremental -var fingerprint=*.css")
+		assert.True(t, err == nil)
+		manifest := map[string]string{}
+		text, _ := fsx.ReadFile(filepath.Join(tmpdir, "build", fingerprintManifest))
+		assert.True(t, json.Unmarshal([]byte(text), &manifest) == nil)
+		return manifest
+	}
+
+	manifest := build()
+	fp := manifest["main.css"]
+	assert.ContainsPattern(t, fp, `^main\.[0-9a-f]{8}\.css$`)
+	assert.Equal(t, 1, len(manifest))
+	assert.True(t, fsx.FileExists(filepath.Join(tmpdir, "build", fp)))
+	assert.False(t, fsx.FileExists(filepath.Join(tmpdir, "build", "main.css")))
+	html, _ := fsx.ReadFile(filepath.Join(tmpdir, "build", "fingerprint.html"))
+	assert.Contains(t, html, `href="http://example.com/`+fp+`"`)
+	assert.Contains(t, html, `<div title="http://example.com/`+fp+`"></div>`)
+	html, _ = fsx.ReadFile(filepath.Join(tmpdir, "build", "indexes", "posts", "docs-1.html"))
+	assert.Contains(t, html, `href="http://example.com/`+fp+`"`)
+
+	// Unchanged fingerprinted files are cached by incremental builds.
+	manifest = build()
+	assert.Equal(t, fp, manifest["main.css"])
+
+	// Changed files are written with a new fingerprint.
+	f := filepath.Join(tmpdir, "content", "main.css")
+	text, _ := fsx.ReadFile(f)
+	fsx.WriteFile(f, text+"\np { color: red; }\n")
+	manifest = build()
+	assert.True(t, manifest["main.css"] != fp)
+	assert.False(t, fsx.FileExists(filepath.Join(tmpdir, "build", fp)))
+	html, _ = fsx.ReadFile(filepath.Join(tmpdir, "build", "fingerprint.html"))
+	assert.Contains(t, html, `href="http://example.com/`+manifest["main.css"]+`"`)
+}
+
+func TestAssetBundles(t *testing.T) {
+	tmpdir := initTestSite(t, "hindsite-asset-bundles-tests")
+	fsx.WritePath(filepath.Join(tmpdir, "content", "css", "a.css"), "p {\n  color: red;\n}\n")
+	fsx.WriteFile(filepath.Join(tmpdir, "content", "css", "b.css"), "/* Comment. */\nh1 { color: blue; }")
+	fsx.WritePath(filepath.Join(tmpdir, "content", "js", "a.js"), "var a = 1\n")
+	fsx.WriteFile(filepath.Join(tmpdir, "content", "js", "b.js"), "(function() {})()\n")
+	build := func(vars string) (string, error) {
+		return execute("hindsite build -site " + tmpdir + " -var bundles=css/bundle.css:css/a.css,css/b.css|app.js:js/a.js,js/b.js" + vars)
+	}
+
+	_, err := build("")
+	assert.True(t, err == nil)
+	css, _ := fsx.ReadFile(filepath.Join(tmpdir, "build", "css", "bundle.css"))
+	assert.Equal(t, "p {\n  color: red;\n}\n/* Comment. */\nh1 { color: blue; }\n", css)
+	js, _ := fsx.ReadFile(filepath.Join(tmpdir, "build", "app.js"))
+	assert.Equal(t, "var a = 1;\n(function() {})()\n", js)
+	assert.False(t, fsx.FileExists(filepath.Join(tmpdir, "build", "css", "a.css")))
+	assert.False(t, fsx.FileExists(filepath.Join(tmpdir, "build", "js", "a.js")))
+
+	// Minified and fingerprinted bundles.
+	_, err = build(" -var minify=true -var fingerprint=css/*")
+	assert.True(t, err == nil)
+	text, _ := fsx.ReadFile(filepath.Join(tmpdir, "build", fingerprintManifest))
+	manifest := map[string]string{}
+	assert.True(t, json.Unmarshal([]byte(text), &manifest) == nil)
+	assert.ContainsPattern(t, manifest["css/bundle.css"], `^css/bundle\.[0-9a-f]{8}\.css$`)
+	css, _ = fsx.ReadFile(filepath.Join(tmpdir, "build", filepath.FromSlash(manifest["css/bundle.css"])))
+	assert.Equal(t, "p{color:red}h1{color:blue}", css)
+	js, _ = fsx.ReadFile(filepath.Join(tmpdir, "build", "app.js"))
+	assert.Equal(t, "var a=1;(function(){})()", js)
+
+	// Missing bundle sources are non-fatal errors.
+	os.Remove(filepath.Join(tmpdir, "content", "js", "b.js"))
+	out, err := build("")
+	assert.True(t, err == ErrNonFatal)
+	assert.Contains(t, out, `bundle: "app.js": `)
+
+	// Illegal bundles.
+	_, err = build(" -var bundles=bundle.txt:a.txt")
+	assert.Equal(t, `config variable: illegal bundle: "bundle.txt:a.txt"`, err.Error())
+	_, err = build(" -var bundles=bundle.css:a.js")
+	assert.Equal(t, `config variable: illegal bundle source: "a.js"`, err.Error())
+	_, err = build(" -var bundles=bundle.css:../a.css")
+	assert.Equal(t, `config variable: illegal bundle source: "../a.css"`, err.Error())
+}
+
+func TestTemplateFuncs(t *testing.T) {
+	site := New()
+	site.confs = []config{{urlprefix: "/blog"}}
+	site.confs[0].timezone, _ = time.LoadLocation("UTC")
+	tmpls := newTextTemplates("", site.templateFuncs())
+	data := templateData{
+		"date": time.Date(2022, 3, 4, 23, 30, 0, 0, time.UTC),
+		"tags": []map[string]string{{"tag": "foo"}, {"tag": "bar"}},
+	}
+	tests := []struct {
+		text string
+		want string
+	}{
+		{`{{dateFormat "2006-01-02 15:04" .date}}`, "2022-03-04 23:30"},
+		{`{{dateFormat "2006-01-02 15:04" .date "Pacific/Auckland"}}`, "2022-03-05 12:30"},
+		{`{{dateFormat "Jan 2, 2006" "2022-03-04"}}`, "Mar 4, 2022"},
+		{`{{slugify "Hello, World!"}}`, "hello-world"},
+		{`{{markdownify "*foo*"}}`, "<p><em>foo</em></p>\n"},
+		{`{{"Lorem ipsum dolor" | truncate 11}}`, "Lorem ipsum…"},
+		{`{{"Lorem" | truncate 11}}`, "Lorem"},
+		{`{{"foo" | upper}} {{"FOO" | lower}} {{"foo bar" | title}} {{" foo " | trim}}`, "FOO foo Foo Bar foo"},
+		{`{{"foo bar" | replace "bar" "baz"}}`, "foo baz"},
+		{`{{"foo bar" | contains "o b"}} {{"foo" | hasPrefix "f"}} {{"foo" | hasSuffix "f"}}`, "true true false"},
+		{`{{"a,b" | split "," | join "|"}}`, "a|b"},
+		{`{{join ", " .tags}}`, "foo, bar"},
+		{`{{add 1 2}} {{sub 1 2}} {{mul 2 3}} {{div 7 2}} {{mod 7 2}}`, "3 -1 6 3 1"},
+		{`{{urlize "/posts/"}} {{urlize "/blog/posts/"}} {{urlize "posts/"}} {{absURL "//example.com"}}`, "/blog/posts/ /blog/posts/ posts/ //example.com"},
+	}
+	funcs := site.contextFuncs(site.confs[0], ".md")
+	for _, tt := range tests {
+		got, err := tmpls.render("test", tt.text, data, funcs)
+		assert.True(t, err == nil)
+		assert.Equal(t, tt.want, got)
+	}
+	_, err := tmpls.render("test", `{{div 1 0}}`, data, funcs)
+	assert.Contains(t, err.Error(), "div: division by zero")
+
+	// absURL requires an absolute urlprefix.
+	_, err = tmpls.render("test", `{{absURL "/posts/"}}`, data, funcs)
+	assert.Contains(t, err.Error(), `absURL: requires an absolute urlprefix: "/blog"`)
+	_, err = tmpls.render("test", `{{absURL "posts/"}}`, data, funcs)
+	assert.Contains(t, err.Error(), `absURL: URL is not root-relative: "posts/"`)
+	site.confs[0].urlprefix = "https://example.com/blog"
+	got, err := tmpls.render("test", `{{absURL "/posts/"}} {{absURL "https://example.org/"}}`, data, funcs)
+	assert.True(t, err == nil)
+	assert.Equal(t, "https://example.com/blog/posts/ https://example.org/", got)
+
+	// Context functions are bound to the rendering configuration and markup.
+	conf := site.confs[0]
+	conf.timezone, _ = time.LoadLocation("Pacific/Auckland")
+	funcs = site.contextFuncs(conf, ".rmu")
+	got, err = tmpls.render("test", `{{dateFormat "2006-01-02 15:04" .date}}`, data, funcs)
+	assert.True(t, err == nil)
+	assert.Equal(t, "2022-03-05 12:30", got)
+	got, err = tmpls.render("test", `{{markdownify "\"\"foo\"\""}}`, data, funcs)
+	assert.True(t, err == nil)
+	assert.Equal(t, string(site.renderMarkup(`""foo""`, ".rmu")), got)
+	assert.NotEqual(t, string(site.renderMarkup(`""foo""`, ".md")), got)
+}
+
+func TestTemplateFuncsTimezone(t *testing.T) {
+	tmpdir := initTestSite(t, "hindsite-template-funcs-tests")
+	fsx.WritePath(filepath.Join(tmpdir, "template", "notes", "config.toml"), "timezone = \"UTC\"\n")
+	fsx.WritePath(filepath.Join(tmpdir, "content", "notes", "utc.md"),
+		"---\ndate: 2022-03-05 12:30:00+13:00\ntemplates: \"*\"\n---\n{{dateFormat \"2006-01-02 15:04\" .date}}\n")
+	fsx.WritePath(filepath.Join(tmpdir, "content", "local.md"),
+		"---\ndate: 2022-03-05 12:30:00+13:00\ntemplates: \"*\"\n---\n{{dateFormat \"2006-01-02 15:04\" .date}}\n")
+	_, err := execute("hindsite build -site " + tmpdir)
+	assert.True(t, err == nil)
+	html, _ := fsx.ReadFile(filepath.Join(tmpdir, "build", "notes", "utc.html"))
+	assert.Contains(t, html, "2022-03-04 23:30")
+	html, _ = fsx.ReadFile(filepath.Join(tmpdir, "build", "local.html"))
+	assert.Contains(t, html, "2022-03-05 12:30")
+}
+
+func TestDataFiles(t *testing.T) {
+	tmpdir := initTestSite(t, "hindsite-data-tests")
+	dataDir := filepath.Join(tmpdir, "template", "data")
+	fsx.WritePath(filepath.Join(dataDir, "menu.yaml"), "- name: Home\n  url: /index.html\n- name: About\n  url: /about.html\n")
+	fsx.WritePath(filepath.Join(dataDir, "team", "members.json"), `{"lead": {"name": "Joe Bloggs"}}`)
+	fsx.WritePath(filepath.Join(dataDir, "release.toml"), "version = \"1.2.3\"\n")
+	fsx.WritePath(filepath.Join(tmpdir, "content", "data.md"),
+		"---\ntemplates: \"*\"\n---\n{{range .data.menu}}{{.name}}={{.url}} {{end}}\n{{.data.team.members.lead.name}} {{.data.release.version}}\n")
+	f := filepath.Join(tmpdir, "template", "posts", "docs.html")
+	text, _ := fsx.ReadFile(f)
+	fsx.WriteFile(f, text+"<p class=\"release\">{{.data.release.version}}</p>\n")
+	out, err := execute("hindsite build -site " + tmpdir)
+	assert.True(t, err == nil)
+	assert.Contains(t, out, "documents: 12\nstatic: 7")
+	html, _ := fsx.ReadFile(filepath.Join(tmpdir, "build", "data.html"))
+	assert.Contains(t, html, "Home=/index.html About=/about.html")
+	assert.Contains(t, html, "Joe Bloggs 1.2.3")
+	// Paginated and per-term index pages.
+	html, _ = fsx.ReadFile(filepath.Join(tmpdir, "build", "indexes", "posts", "docs-1.html"))
+	assert.Contains(t, html, `<p class="release">1.2.3</p>`)
+	html, _ = fsx.ReadFile(filepath.Join(tmpdir, "build", "indexes", "posts", "tags", "cras-1.html"))
+	assert.Contains(t, html, `<p class="release">1.2.3</p>`)
+
+	// Conflicting data names.
+	fsx.WritePath(filepath.Join(dataDir, "menu.json"), "[]")
+	out, err = execute("hindsite build -site " + tmpdir)
+	assert.True(t, err != nil)
+	assert.ContainsPattern(t, out, `data file: ".*menu.yaml": conflicting data name: "menu"`)
+}
+
+func TestUserVariables(t *testing.T) {
+	tmpdir := initTestSite(t, "hindsite-user-tests")
+	f := filepath.Join(tmpdir, "template", "config.toml")
+	text, _ := fsx.ReadFile(f)
+	fsx.WriteFile(f, text+"\ncomments = true\n\n[user.social]\ntwitter = \"@joe\"\ngithub = \"joe\"\n")
+	fsx.WriteFile(filepath.Join(tmpdir, "content", "user.md"), `---
+templates: "*"
+user:
+  social:
+    github: joebloggs
+  links: [one, two]
+  count: 42
+---
+{{.user.social.twitter}} {{.user.social.github}} {{.user.social.mastodon}} {{.user.comments}} {{range .user.links}}{{.}} {{end}}{{add .user.count 1}}
+`)
+	_, err := execute("hindsite build -site " + tmpdir + " -var user.social.mastodon=@joe@example.com")
+	assert.True(t, err == nil)
+	html, _ := fsx.ReadFile(filepath.Join(tmpdir, "build", "user.html"))
+	assert.Contains(t, html, "@joe joebloggs @joe@example.com true one two 43")
+}
+
+func TestHighlight(t *testing.T) {
+	tmpdir := initTestSite(t, "hindsite-highlight-tests")
+	f := filepath.Join(tmpdir, "content", "posts", "code.md")
+	fsx.WriteFile(f, "# Code\n\n```go\nif x < 1 {\n\treturn \"a&b\"\n}\n```\n\n```foobar\nx < 1\n```\n")
+	_, err := execute("hindsite build -site " + tmpdir + " -var highlight=github")
+	assert.True(t, err == nil)
+	html, _ := fsx.ReadFile(filepath.Join(tmpdir, "build", "posts", "0001-01-01", "code", "index.html"))
+	assert.Contains(t, html, "<pre class=\"highlight\"><code class=\"language-go\"><span class=\"hl-k\">if</span> x &lt; <span class=\"hl-n\">1</span> {\n\t<span class=\"hl-k\">return</span> <span class=\"hl-s\">&#34;a&amp;b&#34;</span>\n}\n</code></pre>")
+	assert.Contains(t, html, "<pre><code class=\"language-foobar\">x &lt; 1\n</code></pre>")
+	css, err := fsx.ReadFile(filepath.Join(tmpdir, "build", "highlight.css"))
+	assert.True(t, err == nil)
+	assert.Contains(t, css, ".highlight .hl-k { color: #d73a49; }")
+	// Rimu code blocks render the language as a `pre` element class.
+	f = filepath.Join(tmpdir, "content", "posts", "rimu-code.rmu")
+	fsx.WriteFile(f, "``` go\nif x < 1 {\n\treturn \"a&b\"\n}\n```\n")
+	_, err = execute("hindsite build -site " + tmpdir + " -var highlight=github")
+	assert.True(t, err == nil)
+	html, _ = fsx.ReadFile(filepath.Join(tmpdir, "build", "posts", "0001-01-01", "rimu-code", "index.html"))
+	assert.Contains(t, html, "<pre class=\"go highlight\"><code><span class=\"hl-k\">if</span> x &lt; <span class=\"hl-n\">1</span> {\n\t<span class=\"hl-k\">return</span> <span class=\"hl-s\">&#34;a&amp;b&#34;</span>\n}")
+	os.Remove(f)
+
+	_, err = execute("hindsite build -site " + tmpdir + " -var highlight=foobar")
+	assert.Equal(t, `config variable: illegal highlight theme: "foobar"`, err.Error())
+}
+
+func TestTOC(t *testing.T) {
+	tmpdir := initTestSite(t, "hindsite-toc-tests")
+	fsx.WriteFile(filepath.Join(tmpdir, "template", "toc.html"), "{{.tochtml}}{{range .toc}}|{{.title}}:{{len .children}}{{end}}\n{{.body}}")
+	f := filepath.Join(tmpdir, "content", "toc.md")
+	fsx.WriteFile(f, "---\nlayout: toc.html\n---\n# Title\n\n## One & Two\n\n### Three\n\n#### Four\n\n<h2>Raw</h2>\n\n## Five\n")
+	_, err := execute("hindsite build -site " + tmpdir)
+	assert.True(t, err == nil)
+	html, _ := fsx.ReadFile(filepath.Join(tmpdir, "build", "toc.html"))
+	assert.Contains(t, html, `<nav class="toc">
+<ul>
+<li><a href="#one-two">One &amp; Two</a>
+<ul>
+<li><a href="#three">Three</a></li>
+</ul>
+</li>
+<li><a href="#raw">Raw</a></li>
+<li><a href="#five">Five</a></li>
+</ul>
+</nav>
+|One &amp; Two:1|Raw:0|Five:0`)
+	assert.Contains(t, html, `<h2 id="raw">Raw</h2>`)
+	assert.Contains(t, html, `<h1 id="title">Title</h1>`)
+
+	_, err = execute("hindsite build -site " + tmpdir + " -var toclevels=1-2 -var anchors=true")
+	assert.True(t, err == nil)
+	html, _ = fsx.ReadFile(filepath.Join(tmpdir, "build", "toc.html"))
+	assert.Contains(t, html, `|Title:3`)
+	assert.Contains(t, html, `<h1 id="title">Title<a class="anchor" href="#title" aria-hidden="true">#</a></h1>`)
+	assert.Contains(t, html, `<h3 id="three">Three</h3>`)
+
+	// Child configurations can disable anchors enabled by the root configuration.
+	f = filepath.Join(tmpdir, "template", "posts", "config.yaml")
+	text, _ := fsx.ReadFile(f)
+	fsx.WriteFile(f, text+"\nanchors: false\n")
+	fsx.WriteFile(filepath.Join(tmpdir, "content", "posts", "toc.md"), "---\ndate: 2020-01-02\n---\n## Heading\n")
+	_, err = execute("hindsite build -site " + tmpdir + " -var anchors=true")
+	assert.True(t, err == nil)
+	html, _ = fsx.ReadFile(filepath.Join(tmpdir, "build", "posts", "2020-01-02", "toc", "index.html"))
+	assert.Contains(t, html, `<h2 id="heading">Heading</h2>`)
+	html, _ = fsx.ReadFile(filepath.Join(tmpdir, "build", "toc.html"))
+	assert.Contains(t, html, `<a class="anchor" href="#one-two" aria-hidden="true">#</a>`)
+
+	_, err = execute("hindsite build -site " + tmpdir + " -var toclevels=3-2")
+	assert.Equal(t, `config variable: illegal toclevels: "3-2"`, err.Error())
+}
+
+func TestRelated(t *testing.T) {
+	tmpdir := initTestSite(t, "hindsite-related-tests")
+	fsx.WriteFile(filepath.Join(tmpdir, "template", "related.html"), "{{range .related}}{{.title}}|{{end}}")
+	for _, doc := range []string{
+		"r0: [xx, yy, zz]: 2020-01-05: related.html",
+		"r1: [xx, yy, zz]: 2020-01-01: layout.html",
+		"r2: [yy, xx]: 2020-01-02: layout.html",
+		"r3: [xx]: 2020-01-03: layout.html",
+		"r4: [zz]: 2020-01-04: layout.html",
+		"r5: [aa]: 2020-01-06: layout.html",
+	} {
+		s := strings.Split(doc, ": ")
+		fsx.WriteFile(filepath.Join(tmpdir, "content", "posts", s[0]+".md"),
+			"---\ntitle: "+s[0]+"\ntags: "+s[1]+"\ndate: "+s[2]+"\nlayout: "+s[3]+"\n---\n")
+	}
+	build := func(args string) string {
+		_, err := execute("hindsite build -site " + tmpdir + args)
+		assert.True(t, err == nil)
+		html, _ := fsx.ReadFile(filepath.Join(tmpdir, "build", "posts", "2020-01-05", "r0", "index.html"))
+		return html
+	}
+	assert.Equal(t, "r1|r2|r4|r3|", build(""))
+	assert.Equal(t, "r1|r2|", build(" -var related=2"))
+	assert.Equal(t, "", build(" -var related=-1"))
+}
+
+func TestArchive(t *testing.T) {
+	tmpdir := initTestSite(t, "hindsite-archive-tests")
+	fsx.WriteFile(filepath.Join(tmpdir, "template", "posts", "archive.html"),
+		"{{range .years}}{{.year}}:{{.count}}:{{.url}}{{range .months}}|{{.name}}:{{.count}}:{{.url}}{{end}}\n{{end}}")
+	fsx.WriteFile(filepath.Join(tmpdir, "template", "posts", "docs.html"),
+		"{{.year}}/{{.month}} {{.monthname}}:{{range .docs}} {{.title}}{{end}}")
+	_, err := execute("hindsite build -site " + tmpdir)
+	assert.True(t, err == nil)
+	indexDir := filepath.Join(tmpdir, "build", "indexes", "posts")
+	html, _ := fsx.ReadFile(filepath.Join(indexDir, "archive.html"))
+	assert.Equal(t, "2017:1:/indexes/posts/archive/2017-1.html|June:1:/indexes/posts/archive/2017/06-1.html\n"+
+		"2016:4:/indexes/posts/archive/2016-1.html|December:1:/indexes/posts/archive/2016/12-1.html|October:1:/indexes/posts/archive/2016/10-1.html|September:1:/indexes/posts/archive/2016/09-1.html|August:1:/indexes/posts/archive/2016/08-1.html\n"+
+		"2015:1:/indexes/posts/archive/2015-1.html|May:1:/indexes/posts/archive/2015/05-1.html\n", html)
+	html, _ = fsx.ReadFile(filepath.Join(indexDir, "archive", "2016-1.html"))
+	assert.Equal(t, "2016/ : Text Template Test Sed Sed Parturient Sed Mattis Dis", html)
+	html, _ = fsx.ReadFile(filepath.Join(indexDir, "archive", "2016", "10-1.html"))
+	assert.Equal(t, "2016/10 October: Sed Sed", html)
+	assert.False(t, fsx.FileExists(filepath.Join(indexDir, "archive", "2016-2.html")))
+	assert.False(t, fsx.DirExists(filepath.Join(tmpdir, "build", "indexes", "newsletters", "archive")))
+}
+
+func TestSortOrder(t *testing.T) {
+	tmpdir := initTestSite(t, "hindsite-sort-tests")
+	fsx.WritePath(filepath.Join(tmpdir, "template", "chapters", "docs.html"), "{{range .docs}}{{.title}}|{{end}}")
+	fsx.WriteFile(filepath.Join(tmpdir, "template", "chapter.html"),
+		"{{.title}}:{{if .prev}}{{.prev.url}}{{end}}:{{if .next}}{{.next.url}}{{end}}")
+	for _, doc := range []string{
+		"c1: Introduction: 2020-01-03: 1",
+		"c2: Basics: 2020-01-01: 2",
+		"c3: Advanced: 2020-01-02: 3",
+		"c4: Appendix: 2020-01-04: 3",
+	} {
+		s := strings.Split(doc, ": ")
+		fsx.WritePath(filepath.Join(tmpdir, "content", "chapters", s[0]+".md"),
+			"---\ntitle: "+s[1]+"\ndate: "+s[2]+"\nweight: "+s[3]+"\nlayout: chapter.html\n---\n")
+	}
+	build := func(order string) string {
+		fsx.WriteFile(filepath.Join(tmpdir, "template", "chapters", "config.yaml"), "sort: "+order+"\n")
+		_, err := execute("hindsite build -site " + tmpdir)
+		assert.True(t, err == nil)
+		html, _ := fsx.ReadFile(filepath.Join(tmpdir, "build", "indexes", "chapters", "docs-1.html"))
+		return html
+	}
+	// Documents with equal weights are ordered by date descending.
+	assert.Equal(t, "Introduction|Basics|Appendix|Advanced|", build("weight"))
+	html, _ := fsx.ReadFile(filepath.Join(tmpdir, "build", "chapters", "c2.html"))
+	assert.Equal(t, "Basics:/chapters/c1.html:/chapters/c4.html", html)
+	assert.Equal(t, "Appendix|Introduction|Advanced|Basics|", build("date-desc"))
+	assert.Equal(t, "Basics|Advanced|Introduction|Appendix|", build("date-asc"))
+	assert.Equal(t, "Advanced|Appendix|Basics|Introduction|", build("title"))
+	assert.Equal(t, "Introduction|Basics|Advanced|Appendix|", build("filename"))
+
+	_, err := execute("hindsite build -site " + tmpdir + " -var sort=foobar")
+	assert.Equal(t, `config variable: illegal sort: "foobar"`, err.Error())
+}
+
+func TestTaxonomies(t *testing.T) {
+	tmpdir := initTestSite(t, "hindsite-taxonomies-tests")
+	fsx.WriteFile(filepath.Join(tmpdir, "template", "posts", "categories.html"),
+		"{{.taxonomy}}:{{range .terms}} {{.term}}:{{.count}}:{{.url}}{{end}}")
+	fsx.WriteFile(filepath.Join(tmpdir, "template", "terms.html"),
+		"{{range .categories}}{{.term}}:{{.url}}|{{end}}{{join \",\" .authors}}")
+	for _, doc := range []string{
+		"t1: [Go, Web Dev]: Joe Bloggs",
+		"t2: Go: Ann Other",
+	} {
+		s := strings.Split(doc, ": ")
+		fsx.WriteFile(filepath.Join(tmpdir, "content", "posts", s[0]+".md"),
+			"---\ntitle: "+s[0]+"\ncategory: "+s[1]+"\nauthor: "+s[2]+"\nlayout: terms.html\n---\n")
+	}
+	build := func(args string) error {
+		_, err := execute("hindsite build -site " + tmpdir + args)
+		return err
+	}
+	err := build(" -var taxonomies=categories:category|authors:author")
+	assert.True(t, err == nil)
+	indexDir := filepath.Join(tmpdir, "build", "indexes", "posts")
+	html, _ := fsx.ReadFile(filepath.Join(indexDir, "categories.html"))
+	assert.Equal(t, "categories: Go:2:/indexes/posts/categories/go-1.html Web Dev:1:/indexes/posts/categories/web-dev-1.html", html)
+	assert.True(t, fsx.FileExists(filepath.Join(indexDir, "categories", "go-1.html")))
+	assert.True(t, fsx.FileExists(filepath.Join(indexDir, "categories", "web-dev-1.html")))
+	assert.True(t, fsx.FileExists(filepath.Join(indexDir, "tags.html")))
+	// The authors taxonomy has no index template.
+	assert.False(t, fsx.DirExists(filepath.Join(indexDir, "authors")))
+	html, _ = fsx.ReadFile(filepath.Join(tmpdir, "build", "posts", "0001-01-01", "t1", "index.html"))
+	assert.Equal(t, "Go:/indexes/posts/categories/go-1.html|Web Dev:/indexes/posts/categories/web-dev-1.html|Joe Bloggs", html)
+	html, _ = fsx.ReadFile(filepath.Join(tmpdir, "build", "posts", "0001-01-01", "t2", "index.html"))
+	assert.Equal(t, "Go:/indexes/posts/categories/go-1.html|Ann Other", html)
+
+	err = build(" -var taxonomies=docs")
+	assert.Equal(t, `config variable: illegal taxonomy: "docs"`, err.Error())
+	// Taxonomy names cannot clash with built-in document template variables.
+	for _, name := range []string{"series", "author", "title", "url", "body", "related", "description"} {
+		err = build(" -var taxonomies=" + name)
+		assert.Equal(t, `config variable: illegal taxonomy: "`+name+`"`, err.Error())
+	}
+	err = build(" -var taxonomies=Bad:category")
+	assert.Equal(t, `config variable: illegal taxonomy: "Bad:category"`, err.Error())
+	// Every document front matter template variable is a reserved taxonomy name.
+	site := New()
+	site.out = make(chan string, 1000)
+	assert.True(t, site.parseArgs(strings.Split("hindsite build -site "+tmpdir, " ")) == nil)
+	assert.True(t, site.parseConfigFiles() == nil)
+	doc, err := newDocument(filepath.Join(tmpdir, "content", "posts", "t1.md"), &site)
+	assert.True(t, err == nil)
+	doc.prev, doc.next = &doc, &doc
+	for name := range doc.frontMatter() {
+		if !slice.New(reservedTaxonomies...).Has(name) {
+			t.Errorf("unreserved document template variable: %q", name)
+		}
+	}
+}
+
+func TestSeries(t *testing.T) {
+	tmpdir := initTestSite(t, "hindsite-series-tests")
+	fsx.WriteFile(filepath.Join(tmpdir, "template", "series.html"),
+		"{{with .series}}{{.title}} {{.position}}/{{.count}}:{{range .docs}} {{.title}}{{end}}"+
+			":{{if .prev}}{{.prev.title}}{{end}}:{{if .next}}{{.next.url}}{{end}}{{end}}|{{if .next}}{{.next.url}}{{end}}")
+	for _, doc := range []string{
+		"s1: Go Generics: 2: 2020-01-01",
+		"s2: Go Generics: 1: 2020-01-03",
+		"s3: Go Generics: 0: 2020-01-02",
+		"s4: Rust: 1: 2020-01-04",
+	} {
+		s := strings.Split(doc, ": ")
+		fsx.WriteFile(filepath.Join(tmpdir, "content", "posts", s[0]+".md"),
+			"---\ntitle: "+s[0]+"\nseries: "+s[1]+"\nseries_part: "+s[2]+"\ndate: "+s[3]+"\nlayout: series.html\n---\n")
+	}
+	_, err := execute("hindsite build -site " + tmpdir)
+	assert.True(t, err == nil)
+	read := func(name, date string) string {
+		html, _ := fsx.ReadFile(filepath.Join(tmpdir, "build", "posts", date, name, "index.html"))
+		return html
+	}
+	// Series navigation sits alongside the primary index next document.
+	assert.Equal(t, "Go Generics 1/3: s2 s1 s3::/posts/2020-01-01/s1/|/posts/2020-01-02/s3/", read("s2", "2020-01-03"))
+	assert.Equal(t, "Go Generics 2/3: s2 s1 s3:s2:/posts/2020-01-02/s3/|/posts/2017-06-07/2017-06-07-document-with-no-front-matter/", read("s1", "2020-01-01"))
+	assert.Equal(t, "Go Generics 3/3: s2 s1 s3:s1:|/posts/2020-01-01/s1/", read("s3", "2020-01-02"))
+	assert.Equal(t, "Rust 1/1: s4::|/posts/2020-01-03/s2/", read("s4", "2020-01-04"))
+}
+
+func TestSearch(t *testing.T) {
+	tmpdir := initTestSite(t, "hindsite-search-tests")
+	fsx.WriteFile(filepath.Join(tmpdir, "content", "posts", "find-me.md"),
+		"---\ntitle: Find Me\ndescription: A *searchable* post.\ntags: [foo, bar]\n---\n# Heading\nSome &amp; <b>bold</b>\ntext.\n<script>ignored()</script>\n")
+	fsx.WriteFile(filepath.Join(tmpdir, "content", "posts", "hide-me.md"),
+		"---\ntitle: Hide Me\nsearch: false\n---\nHidden text.\n")
+	build := func(args string) (entries []searchEntry, posts []searchEntry) {
+		_, err := execute("hindsite build -site " + tmpdir + " -var search=site|indexes" + args)
+		assert.True(t, err == nil)
+		text, _ := fsx.ReadFile(filepath.Join(tmpdir, "build", "search.json"))
+		assert.True(t, json.Unmarshal([]byte(text), &entries) == nil)
+		text, _ = fsx.ReadFile(filepath.Join(tmpdir, "build", "indexes", "posts", "search.json"))
+		assert.True(t, json.Unmarshal([]byte(text), &posts) == nil)
+		return
+	}
+	check := func(entries, posts []searchEntry) {
+		assert.Equal(t, 11, len(entries))
+		assert.Equal(t, 7, len(posts))
+		var doc searchEntry
+		for _, e := range entries {
+			assert.True(t, e.Title != "Hide Me")
+			if e.Title == "Find Me" {
+				doc = e
+			}
+		}
+		assert.Equal(t, "http://example.com/posts/0001-01-01/find-me/", doc.URL)
+		assert.Equal(t, "A searchable post.", doc.Description)
+		assert.Equal(t, "foo|bar", strings.Join(doc.Tags, "|"))
+		assert.Equal(t, "Heading Some & bold text.", doc.Text)
+	}
+	check(build(""))
+	// Unchanged documents are included in incremental builds.
+	check(build(" -incremental"))
+	check(build(" -incremental"))
+
+	_, err := execute("hindsite build -site " + tmpdir + " -var search=foobar")
+	assert.Equal(t, `config variable: illegal search value: "foobar"`, err.Error())
+}
+
+func TestAliases(t *testing.T) {
+	tmpdir := initTestSite(t, "hindsite-aliases-tests")
+	fsx.WriteFile(filepath.Join(tmpdir, "content", "moved.md"), "---\naliases: [/old/moved.html, /old-dir/]\n---\nMoved.\n")
+	build := func(args string) (string, error) {
+		return execute("hindsite build -site " + tmpdir + args)
+	}
+	_, err := build(" -var redirects=netlify")
+	assert.True(t, err == nil)
+	for _, f := range []string{"old/moved.html", "old-dir/index.html"} {
+		html, _ := fsx.ReadFile(filepath.Join(tmpdir, "build", filepath.FromSlash(f)))
+		assert.Contains(t, html, `<link rel="canonical" href="http://example.com/moved.html">`)
+		assert.Contains(t, html, `<meta http-equiv="refresh" content="0; url=http://example.com/moved.html">`)
+	}
+	text, _ := fsx.ReadFile(filepath.Join(tmpdir, "build", "_redirects"))
+	assert.Equal(t, "/old/moved.html http://example.com/moved.html 301\n/old-dir/ http://example.com/moved.html 301\n", text)
+
+	_, err = build(" -var redirects=nginx")
+	assert.True(t, err == nil)
+	text, _ = fsx.ReadFile(filepath.Join(tmpdir, "build", "redirects.map"))
+	assert.Equal(t, "/old/moved.html http://example.com/moved.html;\n/old-dir/ http://example.com/moved.html;\n", text)
+
+	// Aliases that collide with document build paths are rejected.
+	fsx.WriteFile(filepath.Join(tmpdir, "content", "clash.md"), "---\naliases: [/moved.html]\n---\nClash.\n")
+	out, err := build("")
+	assert.True(t, err == ErrNonFatal)
+	assert.Contains(t, out, `"`+filepath.ToSlash(filepath.Join(tmpdir, "content", "moved.md"))+`": document build path is an alias in: "`+filepath.ToSlash(filepath.Join(tmpdir, "content", "clash.md"))+`"`)
+	fsx.WriteFile(filepath.Join(tmpdir, "content", "clash.md"), "---\naliases: [/old-dir]\n---\nClash.\n")
+	out, err = build("")
+	assert.True(t, err == ErrNonFatal)
+	assert.Contains(t, out, `"`+filepath.ToSlash(filepath.Join(tmpdir, "content", "moved.md"))+`": duplicate alias build path "`+filepath.ToSlash(filepath.Join(tmpdir, "build", "old-dir", "index.html"))+`" in: "`+filepath.ToSlash(filepath.Join(tmpdir, "content", "clash.md"))+`"`)
+	fsx.WriteFile(filepath.Join(tmpdir, "content", "clash.md"), "---\naliases: [old.html]\n---\nClash.\n")
+	out, err = build("")
+	assert.True(t, err == ErrNonFatal)
+	assert.Contains(t, out, `illegal alias: "old.html"`)
+
+	_, err = build(" -var redirects=foobar")
+	assert.Equal(t, `config variable: illegal redirects: "foobar"`, err.Error())
+}
+
+func TestPageBundles(t *testing.T) {
+	tmpdir := initTestSite(t, "hindsite-bundles-tests")
+	bundle := filepath.Join(tmpdir, "content", "posts", "trip")
+	fsx.WritePath(filepath.Join(bundle, "index.md"),
+		"---\ntitle: Trip\ndate: 2020-01-01\ntemplates: \"*\"\n---\n{{range .resources}}[{{.name}}]({{.url}}) {{end}}\n")
+	fsx.WritePath(filepath.Join(bundle, "photo.jpg"), "photo")
+	fsx.WritePath(filepath.Join(bundle, "notes.txt"), "notes")
+	fsx.WritePath(filepath.Join(bundle, "other.md"), "---\ntitle: Other\ndate: 2020-01-02\n---\nOther.\n")
+	fsx.WritePath(filepath.Join(bundle, "extra", "extra.txt"), "extra")
+	build := func(args string) {
+		_, err := execute("hindsite build -site " + tmpdir + args)
+		assert.True(t, err == nil)
+	}
+	check := func(photo string) {
+		dir := filepath.Join(tmpdir, "build", "posts", "2020-01-01", "trip")
+		html, _ := fsx.ReadFile(filepath.Join(dir, "index.html"))
+		assert.Contains(t, html, `<a href="http://example.com/posts/2020-01-01/trip/notes.txt">notes.txt</a> <a href="http://example.com/posts/2020-01-01/trip/photo.jpg">photo.jpg</a>`)
+		text, _ := fsx.ReadFile(filepath.Join(dir, "photo.jpg"))
+		assert.Equal(t, photo, text)
+		assert.True(t, fsx.FileExists(filepath.Join(dir, "notes.txt")))
+		assert.False(t, fsx.FileExists(filepath.Join(tmpdir, "build", "posts", "trip", "photo.jpg")))
+		// Sibling documents and subdirectories are not bundle resources.
+		assert.True(t, fsx.FileExists(filepath.Join(tmpdir, "build", "posts", "2020-01-02", "other", "index.html")))
+		assert.True(t, fsx.FileExists(filepath.Join(tmpdir, "build", "posts", "trip", "extra", "extra.txt")))
+	}
+	build("")
+	check("photo")
+	build(" -incremental")
+	check("photo")
+	// Changed resources are copied by incremental builds.
+	time.Sleep(10 * time.Millisecond)
+	fsx.WritePath(filepath.Join(bundle, "photo.jpg"), "new photo")
+	build(" -incremental")
+	check("new photo")
+}
+
+func TestImageDerivatives(t *testing.T) {
+	tmpdir := initTestSite(t, "hindsite-images-tests")
+	writeImage := func(width, height int) {
+		var buf bytes.Buffer
+		png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height)))
+		fsx.WritePath(filepath.Join(tmpdir, "content", "images", "test.png"), buf.String())
+	}
+	writeImage(200, 100)
+	fsx.WriteFile(filepath.Join(tmpdir, "content", "gallery.md"),
+		"---\ntemplates: \"*\"\n---\n<div title=\"{{srcset \"/images/test.png\"}}|{{thumbnail \"/images/test.png\"}}\"></div>\n\n![test](/images/test.png)\n")
+	build := func(args string) {
+		_, err := execute("hindsite build -site " + tmpdir + " -var imagewidths=50|100|400 -var thumbnail=20x20" + args)
+		assert.True(t, err == nil)
+	}
+	derivatives := func() []string {
+		files, _ := filepath.Glob(filepath.Join(tmpdir, "build", "images", "test-*.png"))
+		for i := range files {
+			files[i] = filepath.Base(files[i])
+		}
+		return files
+	}
+	check := func(width int) {
+		assert.Equal(t, "test-100w.png|test-50w.png|test-thumb.png", strings.Join(derivatives(), "|")) // Images are not enlarged.
+		f, _ := os.Open(filepath.Join(tmpdir, "build", "images", "test-thumb.png"))
+		cfg, _ := png.DecodeConfig(f)
+		f.Close()
+		assert.Equal(t, "20x20", fmt.Sprintf("%dx%d", cfg.Width, cfg.Height))
+		f, _ = os.Open(filepath.Join(tmpdir, "build", "images", "test-100w.png"))
+		cfg, _ = png.DecodeConfig(f)
+		f.Close()
+		assert.Equal(t, fmt.Sprintf("100x%d", 100*width/200), fmt.Sprintf("%dx%d", cfg.Width, cfg.Height))
+	}
+	build("")
+	check(100)
+	srcset := "http://example.com/images/test-50w.png 50w, http://example.com/images/test-100w.png 100w, http://example.com/images/test.png 200w"
+	html, _ := fsx.ReadFile(filepath.Join(tmpdir, "build", "gallery.html"))
+	assert.Contains(t, html, srcset+"|http://example.com/images/test-thumb.png")
+	assert.Contains(t, html, `<img src="http://example.com/images/test.png" srcset="`+srcset+`" alt="test" />`)
+	build(" -incremental")
+	check(100)
+	// Changed images are rebuilt by incremental builds.
+	time.Sleep(10 * time.Millisecond)
+	writeImage(200, 50)
+	build(" -incremental")
+	check(50)
+	// Up to date derivatives are skipped by builds that keep the build directory.
+	args := "hindsite build -site " + tmpdir + " -keep -vv -var imagewidths=50|100|400 -var thumbnail=20x20"
+	out, err := execute(args)
+	assert.True(t, err == nil)
+	assert.Contains(t, out, `skip current image: "`+filepath.ToSlash(filepath.Join(tmpdir, "build", "images", "test-100w.png"))+`"`)
+	assert.False(t, strings.Contains(out, `write image:`))
+	check(50)
+	// Derivatives older than their image are rebuilt.
+	time.Sleep(10 * time.Millisecond)
+	writeImage(200, 100)
+	out, err = execute(args)
+	assert.True(t, err == nil)
+	assert.Contains(t, out, `write image: "`+filepath.ToSlash(filepath.Join(tmpdir, "build", "images", "test-100w.png"))+`"`)
+	check(100)
+	// Derivatives with changed dimensions are rebuilt.
+	out, err = execute(strings.Replace(args, "20x20", "30x30", 1))
+	assert.True(t, err == nil)
+	assert.Contains(t, out, `write image: "`+filepath.ToSlash(filepath.Join(tmpdir, "build", "images", "test-thumb.png"))+`"`)
+	assert.False(t, strings.Contains(out, `write image: "`+filepath.ToSlash(filepath.Join(tmpdir, "build", "images", "test-100w.png"))+`"`))
+	// JPEG derivatives with a changed quality are rebuilt.
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 200, 100)), nil)
+	fsx.WritePath(filepath.Join(tmpdir, "content", "images", "test.jpg"), buf.String())
+	jpg := `"` + filepath.ToSlash(filepath.Join(tmpdir, "build", "images", "test-100w.jpg")) + `"`
+	out, err = execute(args)
+	assert.True(t, err == nil)
+	assert.Contains(t, out, `write image: `+jpg)
+	out, err = execute(args)
+	assert.True(t, err == nil)
+	assert.Contains(t, out, `skip current image: `+jpg)
+	out, err = execute(args + " -var jpegquality=50")
+	assert.True(t, err == nil)
+	assert.Contains(t, out, `write image: `+jpg)
+	out, err = execute(args + " -var jpegquality=50")
+	assert.True(t, err == nil)
+	assert.Contains(t, out, `skip current image: `+jpg)
+	// Incremental builds rebuild derivatives when the image configuration changes.
+	_, err = execute(strings.Replace(args, "-keep", "-incremental", 1))
+	assert.True(t, err == nil)
+	out, err = execute(strings.Replace(args, "-keep", "-incremental", 1) + " -var jpegquality=60")
+	assert.True(t, err == nil)
+	assert.Contains(t, out, `write image: `+jpg)
+	os.Remove(filepath.Join(tmpdir, "content", "images", "test.jpg"))
+	// Image derivatives are cached until the image is modified.
+	site := New()
+	site.out = make(chan string, 1000)
+	err = site.parseArgs(strings.Split(args, " "))
+	assert.True(t, err == nil)
+	err = site.parseConfigFiles()
+	assert.True(t, err == nil)
+	f := filepath.Join(tmpdir, "content", "images", "test.png")
+	_, width, err := site.imageDerivatives(f)
+	assert.True(t, err == nil)
+	assert.Equal(t, 200, width)
+	info, _ := os.Stat(f)
+	fsx.WriteFile(f, "not an image")
+	os.Chtimes(f, info.ModTime(), info.ModTime())
+	_, width, err = site.imageDerivatives(f)
+	assert.True(t, err == nil)
+	assert.Equal(t, 200, width)
+	os.Chtimes(f, info.ModTime(), info.ModTime().Add(time.Second))
+	_, _, err = site.imageDerivatives(f)
+	assert.True(t, err != nil)
+}
+
+func TestScheduledPublishing(t *testing.T) {
+	tmpdir := initTestSite(t, "hindsite-schedule-tests")
+	fsx.WriteFile(filepath.Join(tmpdir, "content", "future.md"), "---\ndate: 2999-01-01\n---\nFuture.\n")
+	fsx.WriteFile(filepath.Join(tmpdir, "content", "expired.md"), "+++\nexpires = 2000-01-01\n+++\nExpired.\n")
+	fsx.WriteFile(filepath.Join(tmpdir, "content", "expiring.md"), "---\nexpires: 2999-01-01\n---\nExpiring.\n")
+	build := func(args string) string {
+		out, err := execute("hindsite build -site " + tmpdir + " -v" + args)
+		assert.True(t, err == nil)
+		return out
+	}
+	out := build("")
+	assert.Contains(t, out, "skip future: \""+filepath.ToSlash(filepath.Join(tmpdir, "content", "future.md"))+"\"")
+	assert.Contains(t, out, "skip expired: \""+filepath.ToSlash(filepath.Join(tmpdir, "content", "expired.md"))+"\"")
+	assert.False(t, fsx.FileExists(filepath.Join(tmpdir, "build", "future.html")))
+	assert.False(t, fsx.FileExists(filepath.Join(tmpdir, "build", "expired.html")))
+	assert.True(t, fsx.FileExists(filepath.Join(tmpdir, "build", "expiring.html")))
+
+	build(" -future")
+	assert.True(t, fsx.FileExists(filepath.Join(tmpdir, "build", "future.html")))
+	assert.False(t, fsx.FileExists(filepath.Join(tmpdir, "build", "expired.html")))
+}
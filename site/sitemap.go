@@ -0,0 +1,64 @@
+package site
+
+import (
+	"encoding/xml"
+	"path/filepath"
+	"time"
+)
+
+// sitemapURLSet is the sitemap.xml root element (see https://www.sitemaps.org/protocol.html).
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+// buildSitemap writes `sitemap.xml` listing the site's documents to the root
+// of the build directory along with a `robots.txt` file that references it.
+// Documents with a `sitemap: false` front matter value and the `notfound` page
+// are omitted. The `robots.txt` file is not written if there is one in the
+// content directory.
+func (site *site) buildSitemap() error {
+	homepage := filepath.Join(site.buildDir, "index.html")
+	urlset := sitemapURLSet{XMLNS: "http://www.sitemaps.org/schemas/sitemap/0.9"}
+	for _, k := range sortedKeys(site.docs.byBuildPath) {
+		doc := site.docs.byBuildPath[k]
+		u := sitemapURL{}
+		switch {
+		case k == homepage:
+			u.Loc = site.absURL("/")
+		case doc == nil || !doc.sitemap || k == site.notFoundPage():
+			continue
+		default:
+			u.Loc = site.absURL(doc.url)
+		}
+		if doc != nil {
+			lastmod := doc.modtime
+			if doc.date.After(lastmod) {
+				lastmod = doc.date
+			}
+			u.LastMod = lastmod.In(site.confs[0].timezone).Format(time.RFC3339)
+		}
+		urlset.URLs = append(urlset.URLs, u)
+	}
+	data, err := xml.MarshalIndent(urlset, "", "  ")
+	if err != nil {
+		return err
+	}
+	f := filepath.Join(site.buildDir, "sitemap.xml")
+	site.logVerbose("write sitemap: \"%s\"", f)
+	if err := site.buildFS.WriteFile(f, []byte(xml.Header+string(data)+"\n")); err != nil {
+		return err
+	}
+	if f := filepath.Join(site.contentDir, "robots.txt"); site.vfs(f).FileExists(f) {
+		return nil
+	}
+	f = filepath.Join(site.buildDir, "robots.txt")
+	site.logVerbose("write robots: \"%s\"", f)
+	return site.buildFS.WriteFile(f, []byte("User-agent: *\nAllow: /\n\nSitemap: "+site.absURL("/sitemap.xml")+"\n"))
+}
@@ -3,23 +3,31 @@ package site
 import (
 	"bytes"
 	"path/filepath"
+	"sync"
 	"text/template"
-
-	"github.com/srackham/hindsite/v2/fsx"
 )
 
 type textTemplates struct {
 	templateDir string
 	templates   *template.Template
+	mutex       *sync.Mutex // Serializes render calls (they add templates to the set).
 }
 
-func newTextTemplates(templateDir string) textTemplates {
+func newTextTemplates(templateDir string, funcs map[string]interface{}) textTemplates {
 	tmpls := textTemplates{}
 	tmpls.templateDir = templateDir
-	tmpls.templates = template.New("")
+	tmpls.templates = template.New("").Funcs(funcs)
+	tmpls.mutex = &sync.Mutex{}
 	return tmpls
 }
 
+// contains returns true if named template is in templates.
+func (tmpls textTemplates) contains(name string) bool {
+	tmpls.mutex.Lock()
+	defer tmpls.mutex.Unlock()
+	return tmpls.templates.Lookup(name) != nil
+}
+
 // name joins template file name elements and converts them to template name.
 // The template name is relative to the site template directory and is
 // slash-separated (platform independent).
@@ -31,22 +39,23 @@ func (tmpls textTemplates) name(elem ...string) string {
 	return filepath.ToSlash(name)
 }
 
-// add parses the corresponding file from the templates directory and adds it to
+// add parses the text of a file from the templates directory and adds it to
 // templates.
-func (tmpls *textTemplates) add(tmplfile string) error {
-	text, err := fsx.ReadFile(tmplfile)
-	if err != nil {
-		return err
-	}
+func (tmpls *textTemplates) add(tmplfile, text string) error {
 	name := tmpls.name(tmplfile)
-	if _, err = tmpls.templates.New(name).Parse(text); err != nil {
+	if _, err := tmpls.templates.New(name).Parse(text); err != nil {
 		return err
 	}
 	return nil
 }
 
-// render returns named template text rendered with data.
-func (tmpls textTemplates) render(name, text string, data templateData) (string, error) {
+// render returns named template text rendered with data and with the template
+// functions overridden by funcs.
+// Safe for concurrent use.
+func (tmpls textTemplates) render(name, text string, data templateData, funcs map[string]interface{}) (string, error) {
+	tmpls.mutex.Lock()
+	defer tmpls.mutex.Unlock()
+	tmpls.templates.Funcs(funcs)
 	tmpl, err := tmpls.templates.New(name).Parse(text)
 	if err != nil {
 		return "", err
@@ -57,3 +66,17 @@ func (tmpls textTemplates) render(name, text string, data templateData) (string,
 	}
 	return output.String(), nil
 }
+
+// execute returns the named template rendered with data and with the template
+// functions overridden by funcs.
+// Safe for concurrent use.
+func (tmpls textTemplates) execute(name string, data templateData, funcs map[string]interface{}) (string, error) {
+	tmpls.mutex.Lock()
+	defer tmpls.mutex.Unlock()
+	tmpls.templates.Funcs(funcs)
+	var output bytes.Buffer
+	if err := tmpls.templates.ExecuteTemplate(&output, name, data); err != nil {
+		return "", err
+	}
+	return output.String(), nil
+}
@@ -0,0 +1,85 @@
+package site
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"regexp"
+	"strings"
+
+	"github.com/srackham/hindsite/v2/slice"
+)
+
+var (
+	headingRe = regexp.MustCompile(`(?is)<h([1-6])([^>]*)>(.*?)</h[1-6]>`)
+	idAttrRe  = regexp.MustCompile(`(?i)\sid="([^"]*)"`)
+	htmlTagRe = regexp.MustCompile(`<[^>]*>`)
+)
+
+// buildTOC returns the table of contents of the document body HTML headings
+// whose levels are in the `toclevels` configuration range. Each table of
+// contents entry has `level`, `id`, `title` and `children` (nested entries)
+// values. Headings without an id attribute are assigned one, and if the
+// `anchors` configuration variable is set a self-link anchor is appended to
+// them. The updated body is returned.
+func (doc *document) buildTOC(body string) (string, []templateData) {
+	ids := slice.Slice[string]{}
+	for _, m := range idAttrRe.FindAllStringSubmatch(body, -1) {
+		ids = append(ids, m[1])
+	}
+	toc := []templateData{}
+	stack := []templateData{} // Current entry ancestors.
+	body = headingRe.ReplaceAllStringFunc(body, func(heading string) string {
+		m := headingRe.FindStringSubmatch(heading)
+		level := int(m[1][0] - '0')
+		attrs, content := m[2], m[3]
+		if level < doc.conf.toclevels[0] || level > doc.conf.toclevels[1] {
+			return heading
+		}
+		title := strings.TrimSpace(html.UnescapeString(htmlTagRe.ReplaceAllString(content, "")))
+		var id string
+		if idm := idAttrRe.FindStringSubmatch(attrs); idm != nil {
+			id = idm[1]
+		} else {
+			id = slugify(title, ids)
+			ids = append(ids, id)
+			attrs += fmt.Sprintf(` id="%s"`, id)
+		}
+		if doc.conf.anchors != nil && *doc.conf.anchors {
+			content += fmt.Sprintf(`<a class="anchor" href="#%s" aria-hidden="true">#</a>`, id)
+		}
+		entry := templateData{"level": level, "id": id, "title": title, "children": []templateData{}}
+		for len(stack) > 0 && stack[len(stack)-1]["level"].(int) >= level {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) == 0 {
+			toc = append(toc, entry)
+		} else {
+			parent := stack[len(stack)-1]
+			parent["children"] = append(parent["children"].([]templateData), entry)
+		}
+		stack = append(stack, entry)
+		return fmt.Sprintf("<h%d%s>%s</h%d>", level, attrs, content, level)
+	})
+	return body, toc
+}
+
+// tocHTML renders a table of contents as nested HTML lists.
+func tocHTML(toc []templateData) template.HTML {
+	if len(toc) == 0 {
+		return ""
+	}
+	var render func(entries []templateData) string
+	render = func(entries []templateData) string {
+		result := "<ul>\n"
+		for _, entry := range entries {
+			result += fmt.Sprintf(`<li><a href="#%s">%s</a>`, html.EscapeString(entry["id"].(string)), html.EscapeString(entry["title"].(string)))
+			if children := entry["children"].([]templateData); len(children) > 0 {
+				result += "\n" + render(children)
+			}
+			result += "</li>\n"
+		}
+		return result + "</ul>\n"
+	}
+	return template.HTML(`<nav class="toc">` + "\n" + render(toc) + "</nav>\n")
+}